@@ -0,0 +1,64 @@
+// Package admin exposes the queues and tasks of apps as JSON over HTTP, for
+// the operators.
+//
+//	http.Handle("/asq/", http.StripPrefix("/asq", admin.NewHandler(app)))
+//
+// The endpoints answer 501 if the broker does not implement asq.Inspector or
+// the optional interfaces below:
+//
+//	GET  /workers                         registered workers, see asq.WithRegistry
+//	GET  /queues                          queues with their counts
+//	GET  /queues/{queue}                  counts of a queue
+//	GET  /queues/{queue}/tasks            waiting tasks, ?offset=&count=
+//	GET  /queues/{queue}/delayed          delayed tasks, ?offset=&count=
+//	GET  /queues/{queue}/dead             dead lettered tasks, ?offset=&count=
+//	GET  /queues/{queue}/tasks/{id}       state and result of a task
+//	POST /queues/{queue}/tasks/{id}/revoke
+//	POST /queues/{queue}/dead/{id}/requeue
+//	POST /queues/{queue}/pause
+//	POST /queues/{queue}/resume
+//	POST /queues/{queue}/purge            delete the waiting tasks
+//
+// Task arguments and results are redacted as in the logs.
+package admin
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/task"
+)
+
+// DelayedPeeker lists the delayed tasks, from the earliest due. The waiting
+// tasks are listed by asq.Inspector.
+type DelayedPeeker interface {
+	PeekDelayed(ctx context.Context, offset, count int64) ([]*task.Task, error)
+}
+
+// DeadLetters lists and requeues the tasks kept by an asq.DeadLetterer.
+type DeadLetters interface {
+	DeadLen(ctx context.Context) (int64, error)
+	DeadLetters(ctx context.Context, offset, count int64) ([]*task.Task, error)
+	Requeue(ctx context.Context, id string) (bool, error)
+}
+
+type Revoker interface {
+	Revoke(ctx context.Context, id string) error
+}
+
+// Pauser pauses the consumption of a queue by all workers.
+type Pauser interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	Paused(ctx context.Context) (bool, error)
+}
+
+// queueName names the app by its broker, brokers without a name are named
+// by their index.
+func queueName(app *asq.App, i int) string {
+	if q, ok := app.Broker().(interface{ Name() string }); ok {
+		return q.Name()
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/zigzed/asq"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+type dashboard struct {
+	*handler
+}
+
+// NewDashboard serves a web page over the endpoints of NewHandler, with the
+// throughput, failures and running tasks observed by m. m may be nil if the
+// process runs no workers, the page then shows the queues only.
+//
+//	m := admin.NewMonitor()
+//	app := asq.NewApp(broker, backend, asq.WithListeners(m.Observe))
+//	http.Handle("/asq/", http.StripPrefix("/asq", admin.NewDashboard(m, app)))
+//
+// The page is self-contained, it loads no external assets.
+func NewDashboard(m *Monitor, apps ...*asq.App) http.Handler {
+	h := newHandler(apps)
+	h.monitor = m
+	return &dashboard{handler: h}
+}
+
+func (d *dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "" && r.URL.Path != "/index.html" {
+		d.handler.ServeHTTP(w, r)
+		return
+	}
+	if err := method(r, http.MethodGet); err != nil {
+		d.handler.writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'unsafe-inline'; style-src 'unsafe-inline'")
+	_, _ = w.Write(dashboardPage)
+}
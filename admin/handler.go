@@ -0,0 +1,443 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/log"
+	"github.com/zigzed/asq/registry"
+	"github.com/zigzed/asq/task"
+)
+
+const (
+	defaultCount = 20
+	maxCount     = 1000
+)
+
+type handler struct {
+	apps    map[string]*asq.App
+	names   []string
+	monitor *Monitor
+	logger  asq.Logger
+}
+
+// NewHandler serves the queues of apps, each app is a queue named by its
+// broker. Errors are logged by the logger of the first app.
+func NewHandler(apps ...*asq.App) http.Handler {
+	return newHandler(apps)
+}
+
+func newHandler(apps []*asq.App) *handler {
+	h := &handler{apps: make(map[string]*asq.App), logger: log.Default()}
+	if len(apps) > 0 {
+		h.logger = apps[0].Logger()
+	}
+	for i, app := range apps {
+		name := queueName(app, i)
+		h.apps[name] = app
+		h.names = append(h.names, name)
+	}
+	return h
+}
+
+type queueInfo struct {
+	Name    string `json:"name"`
+	Pending *int64 `json:"pending,omitempty"`
+	Delayed *int64 `json:"delayed,omitempty"`
+	Dead    *int64 `json:"dead,omitempty"`
+	Paused  bool   `json:"paused"`
+}
+
+type taskInfo struct {
+	Id          string            `json:"id"`
+	Name        string            `json:"name"`
+	Args        string            `json:"args"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Attempts    int               `json:"attempts"`
+	StartAt     *time.Time        `json:"start_at,omitempty"`
+	SubmittedAt *time.Time        `json:"submitted_at,omitempty"`
+	OnSuccess   []*taskInfo       `json:"on_success,omitempty"`
+}
+
+type workerInfo struct {
+	*registry.Worker
+	Alive bool `json:"alive"`
+}
+
+type stateInfo struct {
+	Id       string    `json:"id"`
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Worker   string    `json:"worker,omitempty"`
+	Attempts int       `json:"attempts"`
+	Results  string    `json:"results,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// httpError is answered with its status code and message.
+type httpError struct {
+	code int
+	msg  string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(code int, format string, args ...interface{}) error {
+	return &httpError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v, err := h.route(r)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if he, ok := err.(*httpError); ok {
+			code = he.code
+		} else {
+			h.logger.Error("asq: admin request failed", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+		h.writeJSON(w, code, map[string]string{"error": err.Error()})
+		return
+	}
+	h.writeJSON(w, http.StatusOK, v)
+}
+
+func (h *handler) route(r *http.Request) (interface{}, error) {
+	ctx := r.Context()
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if h.monitor != nil && len(parts) == 1 && (parts[0] == "stats" || parts[0] == "running") {
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		if parts[0] == "stats" {
+			return h.monitor.stats(), nil
+		}
+		return h.monitor.runningTasks(), nil
+	}
+	if len(parts) == 1 && parts[0] == "workers" {
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		return h.workers(ctx)
+	}
+	if parts[0] != "queues" {
+		return nil, errorf(http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+	if len(parts) == 1 {
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		return h.queues(ctx)
+	}
+
+	name := parts[1]
+	app, ok := h.apps[name]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "queue %s not found", name)
+	}
+
+	switch path := strings.Join(parts[2:], "/"); {
+	case path == "":
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		return h.queue(ctx, name, app)
+	case path == "tasks", path == "delayed", path == "dead":
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		offset, count, err := page(r)
+		if err != nil {
+			return nil, err
+		}
+		return h.peek(ctx, app, path, offset, count)
+	case path == "purge":
+		if err := method(r, http.MethodPost); err != nil {
+			return nil, err
+		}
+		return h.purge(ctx, app)
+	case path == "pause", path == "resume":
+		if err := method(r, http.MethodPost); err != nil {
+			return nil, err
+		}
+		return h.pause(ctx, app, path == "pause")
+	case len(parts) == 4 && parts[2] == "tasks":
+		if err := method(r, http.MethodGet); err != nil {
+			return nil, err
+		}
+		return h.state(ctx, app, parts[3])
+	case len(parts) == 5 && parts[2] == "tasks" && parts[4] == "revoke":
+		if err := method(r, http.MethodPost); err != nil {
+			return nil, err
+		}
+		return h.revoke(ctx, app, parts[3])
+	case len(parts) == 5 && parts[2] == "dead" && parts[4] == "requeue":
+		if err := method(r, http.MethodPost); err != nil {
+			return nil, err
+		}
+		return h.requeue(ctx, app, parts[3])
+	}
+	return nil, errorf(http.StatusNotFound, "%s not found", r.URL.Path)
+}
+
+func (h *handler) queues(ctx context.Context) (interface{}, error) {
+	queues := make([]*queueInfo, 0, len(h.names))
+	for _, name := range h.names {
+		q, err := h.queue(ctx, name, h.apps[name])
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// workers lists the registries of all the apps, usually they share one.
+func (h *handler) workers(ctx context.Context) (interface{}, error) {
+	var (
+		now     = time.Now()
+		seen    = make(map[string]bool)
+		workers = make([]*workerInfo, 0)
+		found   = false
+	)
+	for _, name := range h.names {
+		ws, err := h.apps[name].Workers(ctx)
+		if errors.Is(err, asq.ErrNoRegistry) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		for _, w := range ws {
+			if !seen[w.Id] {
+				seen[w.Id] = true
+				workers = append(workers, &workerInfo{Worker: w, Alive: w.Alive(now)})
+			}
+		}
+	}
+	if !found {
+		return nil, errorf(http.StatusNotImplemented, "%v", asq.ErrNoRegistry)
+	}
+	return workers, nil
+}
+
+func (h *handler) queue(ctx context.Context, name string, app *asq.App) (*queueInfo, error) {
+	info := &queueInfo{Name: name}
+	if n, err := app.Len(ctx); err == nil {
+		info.Pending = &n
+	} else if !errors.Is(err, asq.ErrNotInspectable) {
+		return nil, err
+	}
+	if n, err := app.DelayedLen(ctx); err == nil {
+		info.Delayed = &n
+	} else if !errors.Is(err, asq.ErrNotInspectable) {
+		return nil, err
+	}
+	if dl, ok := app.Broker().(DeadLetters); ok {
+		n, err := dl.DeadLen(ctx)
+		if err != nil {
+			return nil, err
+		}
+		info.Dead = &n
+	}
+	if p, ok := app.Broker().(Pauser); ok {
+		paused, err := p.Paused(ctx)
+		if err != nil {
+			return nil, err
+		}
+		info.Paused = paused
+	}
+	return info, nil
+}
+
+func (h *handler) peek(ctx context.Context, app *asq.App, which string, offset, count int64) (interface{}, error) {
+	var (
+		tasks []*task.Task
+		err   error
+	)
+	if which == "dead" {
+		dl, ok := app.Broker().(DeadLetters)
+		if !ok {
+			return nil, unsupported("dead letters")
+		}
+		tasks, err = dl.DeadLetters(ctx, offset, count)
+	} else if which == "delayed" {
+		p, ok := app.Broker().(DelayedPeeker)
+		if !ok {
+			return nil, unsupported("delayed peek")
+		}
+		tasks, err = p.PeekDelayed(ctx, offset, count)
+	} else {
+		tasks, err = app.Peek(ctx, offset, count)
+	}
+	if errors.Is(err, asq.ErrNotInspectable) {
+		return nil, unsupported("peek")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*taskInfo, 0, len(tasks))
+	for _, t := range tasks {
+		infos = append(infos, newTaskInfo(app, t))
+	}
+	return infos, nil
+}
+
+func (h *handler) state(ctx context.Context, app *asq.App, id string) (interface{}, error) {
+	if app.States() == nil {
+		return nil, unsupported("task states")
+	}
+	st, err := app.States().State(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		return nil, errorf(http.StatusNotFound, "task %s not found", id)
+	}
+	return &stateInfo{
+		Id:       st.Id,
+		Name:     st.Name,
+		Status:   string(st.Status),
+		Worker:   st.Worker,
+		Attempts: st.Attempts,
+		Results:  st.Results,
+		Error:    st.Error,
+		Updated:  time.UnixMilli(st.Updated),
+	}, nil
+}
+
+func (h *handler) revoke(ctx context.Context, app *asq.App, id string) (interface{}, error) {
+	r, ok := app.Broker().(Revoker)
+	if !ok {
+		return nil, unsupported("revoke")
+	}
+	if err := r.Revoke(ctx, id); err != nil {
+		return nil, err
+	}
+	return map[string]string{"id": id, "status": string(task.StatusRevoked)}, nil
+}
+
+func (h *handler) requeue(ctx context.Context, app *asq.App, id string) (interface{}, error) {
+	dl, ok := app.Broker().(DeadLetters)
+	if !ok {
+		return nil, unsupported("dead letters")
+	}
+	found, err := dl.Requeue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, errorf(http.StatusNotFound, "dead letter %s not found", id)
+	}
+	return map[string]string{"id": id, "status": string(task.StatusPending)}, nil
+}
+
+func (h *handler) purge(ctx context.Context, app *asq.App) (interface{}, error) {
+	n, err := app.Purge(ctx)
+	if errors.Is(err, asq.ErrNotInspectable) {
+		return nil, unsupported("purge")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int64{"purged": n}, nil
+}
+
+func (h *handler) pause(ctx context.Context, app *asq.App, pause bool) (interface{}, error) {
+	p, ok := app.Broker().(Pauser)
+	if !ok {
+		return nil, unsupported("pause")
+	}
+	var err error
+	if pause {
+		err = p.Pause(ctx)
+	} else {
+		err = p.Resume(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]bool{"paused": pause}, nil
+}
+
+func newTaskInfo(app *asq.App, t *task.Task) *taskInfo {
+	info := &taskInfo{
+		Id:       t.Id,
+		Name:     t.Name,
+		Args:     app.RedactArgs(t),
+		Headers:  t.Headers,
+		Attempts: t.EnsureBackOff().Attempts,
+	}
+	if t.Option.StartAt != nil {
+		at := time.UnixMilli(*t.Option.StartAt)
+		info.StartAt = &at
+	}
+	if t.SubmittedAt != 0 {
+		at := time.UnixMilli(t.SubmittedAt)
+		info.SubmittedAt = &at
+	}
+	for _, x := range t.OnSuccess {
+		info.OnSuccess = append(info.OnSuccess, newTaskInfo(app, x))
+	}
+	return info
+}
+
+func method(r *http.Request, m string) error {
+	if r.Method != m {
+		return errorf(http.StatusMethodNotAllowed, "%s %s not allowed", r.Method, r.URL.Path)
+	}
+	// 跨站提交的表单不能带自定义 header，也不能是 JSON，以此防止 CSRF
+	if m == http.MethodPost && r.Header.Get("X-Requested-With") == "" && !isJSON(r) {
+		return errorf(http.StatusForbidden, "%s %s requires the X-Requested-With header", r.Method, r.URL.Path)
+	}
+	return nil
+}
+
+func isJSON(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
+
+func unsupported(what string) error {
+	return errorf(http.StatusNotImplemented, "%s not supported by the broker", what)
+}
+
+func page(r *http.Request) (int64, int64, error) {
+	offset, count := int64(0), int64(defaultCount)
+	q := r.URL.Query()
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, errorf(http.StatusBadRequest, "invalid offset %q", s)
+		}
+		offset = n
+	}
+	if s := q.Get("count"); s != "" {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || n <= 0 || n > maxCount {
+			return 0, 0, errorf(http.StatusBadRequest, "invalid count %q, 1 to %d", s, maxCount)
+		}
+		count = n
+	}
+	return offset, count, nil
+}
+
+func (h *handler) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.logger.Warn("asq: write admin response failed", "error", err)
+	}
+}
@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/log"
+	"github.com/zigzed/asq/registry"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+// fakeBroker 在内存中实现 broker 的可选接口
+type fakeBroker struct {
+	tasks   []*task.Task
+	dead    []*task.Task
+	revoked map[string]bool
+	paused  bool
+}
+
+func (fb *fakeBroker) Name() string { return "default" }
+
+func (fb *fakeBroker) Push(ctx context.Context, t *task.Task) error {
+	fb.tasks = append(fb.tasks, t)
+	return nil
+}
+
+func (fb *fakeBroker) Poll(ctx context.Context, timeout time.Duration) (*task.Task, error) {
+	return nil, nil
+}
+
+func (fb *fakeBroker) Len(ctx context.Context) (int64, error) {
+	return int64(len(fb.tasks)), nil
+}
+
+func (fb *fakeBroker) DelayedLen(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (fb *fakeBroker) Peek(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	return slice(fb.tasks, offset, count), nil
+}
+
+func (fb *fakeBroker) Purge(ctx context.Context) (int64, error) {
+	n := len(fb.tasks)
+	fb.tasks = nil
+	return int64(n), nil
+}
+
+func (fb *fakeBroker) PeekDelayed(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	return nil, nil
+}
+
+func (fb *fakeBroker) DeadLen(ctx context.Context) (int64, error) {
+	return int64(len(fb.dead)), nil
+}
+
+func (fb *fakeBroker) DeadLetters(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	return slice(fb.dead, offset, count), nil
+}
+
+func (fb *fakeBroker) Requeue(ctx context.Context, id string) (bool, error) {
+	for i, t := range fb.dead {
+		if t.Id == id {
+			fb.dead = append(fb.dead[:i], fb.dead[i+1:]...)
+			return true, fb.Push(ctx, t)
+		}
+	}
+	return false, nil
+}
+
+func (fb *fakeBroker) Revoke(ctx context.Context, id string) error {
+	fb.revoked[id] = true
+	return nil
+}
+
+func (fb *fakeBroker) Pause(ctx context.Context) error {
+	fb.paused = true
+	return nil
+}
+
+func (fb *fakeBroker) Resume(ctx context.Context) error {
+	fb.paused = false
+	return nil
+}
+
+func (fb *fakeBroker) Paused(ctx context.Context) (bool, error) {
+	return fb.paused, nil
+}
+
+func slice(tasks []*task.Task, offset, count int64) []*task.Task {
+	if offset >= int64(len(tasks)) {
+		return nil
+	}
+	if end := offset + count; end < int64(len(tasks)) {
+		return tasks[offset:end]
+	}
+	return tasks[offset:]
+}
+
+type fakeStates map[string]*task.State
+
+func (fs fakeStates) SetState(ctx context.Context, st *task.State) error {
+	fs[st.Id] = st
+	return nil
+}
+
+func (fs fakeStates) State(ctx context.Context, id string) (*task.State, error) {
+	return fs[id], nil
+}
+
+type fakeRegistry []*registry.Worker
+
+func (fr fakeRegistry) Heartbeat(ctx context.Context, w *registry.Worker) error { return nil }
+
+func (fr fakeRegistry) Unregister(ctx context.Context, id string) error { return nil }
+
+func (fr fakeRegistry) Workers(ctx context.Context) ([]*registry.Worker, error) {
+	return fr, nil
+}
+
+type nopBackend struct{}
+
+func (nopBackend) Push(ctx context.Context, r *result.Result) error { return nil }
+
+func (nopBackend) Scan(ctx context.Context, id, name string, args ...interface{}) (bool, error) {
+	return false, nil
+}
+
+func do(t *testing.T, h http.Handler, method, path string, v interface{}) int {
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-Requested-With", "test")
+	h.ServeHTTP(rec, r)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %v, %s", method, path, err, rec.Body.String())
+		}
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	is := is.New(t)
+
+	broker := &fakeBroker{revoked: make(map[string]bool)}
+	states := fakeStates{}
+	workers := fakeRegistry{
+		{Id: "w1", Heartbeat: time.Now(), TTL: time.Minute},
+		{Id: "w2", Heartbeat: time.Now().Add(-time.Hour), TTL: time.Minute},
+	}
+	app := asq.NewApp(broker, nopBackend{}, asq.WithStateStore(states), asq.WithRegistry(workers))
+	h := NewHandler(app)
+
+	_, err := app.SubmitTask(context.Background(),
+		task.NewTask(nil, "add", 1, 2), task.NewTask(nil, "print"))
+	is.NoErr(err)
+	id := broker.tasks[0].Id
+	broker.dead = append(broker.dead, task.NewTask(nil, "failed", "x"))
+
+	var queues []queueInfo
+	is.Equal(do(t, h, "GET", "/queues", &queues), http.StatusOK)
+	is.Equal(len(queues), 1)
+	is.Equal(queues[0].Name, "default")
+	is.Equal(*queues[0].Pending, int64(1))
+	is.Equal(*queues[0].Dead, int64(1))
+
+	var ws []map[string]interface{}
+	is.Equal(do(t, h, "GET", "/workers", &ws), http.StatusOK)
+	is.Equal(len(ws), 2)
+	is.Equal(ws[0]["id"], "w1")
+	is.Equal(ws[0]["alive"], true)
+	is.Equal(ws[1]["alive"], false)
+
+	var tasks []taskInfo
+	is.Equal(do(t, h, "GET", "/queues/default/tasks?count=10", &tasks), http.StatusOK)
+	is.Equal(len(tasks), 1)
+	is.Equal(tasks[0].Args, "[1 2]")
+	is.Equal(tasks[0].OnSuccess[0].Name, "print")
+	is.True(tasks[0].SubmittedAt != nil)
+	is.Equal(do(t, h, "GET", "/queues/default/tasks?count=0", nil), http.StatusBadRequest)
+
+	var st stateInfo
+	is.Equal(do(t, h, "GET", "/queues/default/tasks/"+id, &st), http.StatusOK)
+	is.Equal(st.Status, string(task.StatusPending))
+	is.Equal(do(t, h, "GET", "/queues/default/tasks/unknown", nil), http.StatusNotFound)
+
+	is.Equal(do(t, h, "GET", "/queues/default/tasks/"+id+"/revoke", nil), http.StatusMethodNotAllowed)
+	is.Equal(do(t, h, "POST", "/queues/default/tasks/"+id+"/revoke", nil), http.StatusOK)
+	is.True(broker.revoked[id])
+
+	is.Equal(do(t, h, "GET", "/queues/default/dead", &tasks), http.StatusOK)
+	is.Equal(len(tasks), 1)
+	is.Equal(do(t, h, "POST", "/queues/default/dead/"+tasks[0].Id+"/requeue", nil), http.StatusOK)
+	is.Equal(len(broker.dead), 0)
+	is.Equal(len(broker.tasks), 2)
+	is.Equal(do(t, h, "POST", "/queues/default/dead/"+tasks[0].Id+"/requeue", nil), http.StatusNotFound)
+
+	var paused map[string]bool
+	// 没有 X-Requested-With 或 JSON 的 POST 被拒绝
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("POST", "/queues/default/pause", nil))
+	is.Equal(rec.Code, http.StatusForbidden)
+	rec = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/queues/default/pause", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	h.ServeHTTP(rec, r)
+	is.Equal(rec.Code, http.StatusOK)
+
+	is.Equal(do(t, h, "POST", "/queues/default/pause", &paused), http.StatusOK)
+	is.True(broker.paused)
+	is.Equal(do(t, h, "POST", "/queues/default/resume", &paused), http.StatusOK)
+	is.False(broker.paused)
+
+	var purged map[string]int64
+	is.Equal(do(t, h, "POST", "/queues/default/purge", &purged), http.StatusOK)
+	is.Equal(purged["purged"], int64(2))
+	is.Equal(len(broker.tasks), 0)
+
+	is.Equal(do(t, h, "GET", "/queues/other", nil), http.StatusNotFound)
+}
+
+func TestHandlerUnsupported(t *testing.T) {
+	is := is.New(t)
+
+	type pushOnly struct{ asq.Broker }
+	h := NewHandler(asq.NewApp(pushOnly{}, nopBackend{}))
+
+	var queues []queueInfo
+	is.Equal(do(t, h, "GET", "/queues", &queues), http.StatusOK)
+	is.Equal(queues[0].Name, "0")
+	is.True(queues[0].Pending == nil)
+
+	var e map[string]string
+	is.Equal(do(t, h, "POST", "/queues/0/pause", &e), http.StatusNotImplemented)
+	is.True(strings.Contains(e["error"], "pause"))
+	is.Equal(do(t, h, "GET", "/queues/0/tasks/x", nil), http.StatusNotImplemented)
+	is.Equal(do(t, h, "GET", "/queues/0/tasks", nil), http.StatusNotImplemented)
+	is.Equal(do(t, h, "POST", "/queues/0/purge", nil), http.StatusNotImplemented)
+	is.Equal(do(t, h, "GET", "/workers", nil), http.StatusNotImplemented)
+}
+
+type failPurge struct{ *fakeBroker }
+
+func (failPurge) Purge(ctx context.Context) (int64, error) {
+	return 0, errors.New("connection refused")
+}
+
+type memLogger struct {
+	lines *[]string
+}
+
+func (ml memLogger) Infof(format string, args ...interface{}) {
+	*ml.lines = append(*ml.lines, fmt.Sprintf(format, args...))
+}
+
+func (ml memLogger) Errorf(format string, args ...interface{}) {
+	*ml.lines = append(*ml.lines, fmt.Sprintf(format, args...))
+}
+
+func TestHandlerLogger(t *testing.T) {
+	is := is.New(t)
+
+	// 错误记录到 app 的 logger，而不是默认的
+	var lines []string
+	h := NewHandler(asq.NewApp(failPurge{&fakeBroker{}}, nopBackend{}, asq.WithLogger(log.FromPrintf(memLogger{&lines}))))
+	is.Equal(do(t, h, "POST", "/queues/default/purge", nil), http.StatusInternalServerError)
+	is.Equal(len(lines), 1)
+	is.True(strings.Contains(lines[0], "connection refused"))
+}
@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zigzed/asq"
+)
+
+// 统计的时间窗口，按分钟分桶
+const statsWindow = 15
+
+// Monitor is an asq.Listener counting the outcome of tasks per name and the
+// tasks running on each worker, for the dashboard. It only sees the events
+// of the apps in this process.
+//
+//	m := admin.NewMonitor()
+//	app := asq.NewApp(broker, backend, asq.WithListeners(m.Observe))
+type Monitor struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	series  map[string]*series
+	running map[string]map[string]*runningTask
+}
+
+// series 是最近 statsWindow 分钟的计数，minutes 记录桶所属的分钟用于淘汰旧数据
+type series struct {
+	minutes   [statsWindow]int64
+	succeeded [statsWindow]int64
+	failed    [statsWindow]int64
+}
+
+type runningTask struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Attempt int       `json:"attempt"`
+	Started time.Time `json:"started"`
+}
+
+type taskStats struct {
+	Name string `json:"name"`
+	// Succeeded and Failed are the counts per minute, the last is the
+	// current minute
+	Succeeded []int64 `json:"succeeded"`
+	Failed    []int64 `json:"failed"`
+}
+
+type workerTasks struct {
+	Worker string         `json:"worker"`
+	Tasks  []*runningTask `json:"tasks"`
+}
+
+func NewMonitor() *Monitor {
+	return &Monitor{
+		now:     time.Now,
+		series:  make(map[string]*series),
+		running: make(map[string]map[string]*runningTask),
+	}
+}
+
+// Observe is the asq.Listener of the monitor.
+func (m *Monitor) Observe(e asq.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch e.Kind {
+	case asq.EventStarted:
+		tasks, ok := m.running[e.Worker]
+		if !ok {
+			tasks = make(map[string]*runningTask)
+			m.running[e.Worker] = tasks
+		}
+		tasks[e.Task.Id] = &runningTask{
+			Id:      e.Task.Id,
+			Name:    e.Task.Name,
+			Attempt: e.Task.EnsureBackOff().Attempts,
+			Started: m.now(),
+		}
+	case asq.EventSucceeded, asq.EventFailed:
+		if tasks, ok := m.running[e.Worker]; ok {
+			delete(tasks, e.Task.Id)
+			if len(tasks) == 0 {
+				delete(m.running, e.Worker)
+			}
+		}
+		s, ok := m.series[e.Task.Name]
+		if !ok {
+			s = &series{}
+			m.series[e.Task.Name] = s
+		}
+		s.add(m.minute(), e.Kind == asq.EventFailed)
+	}
+}
+
+// stats returns the counts of the last 15 minutes per task name.
+func (m *Monitor) stats() []*taskStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.minute()
+	stats := make([]*taskStats, 0, len(m.series))
+	for name, s := range m.series {
+		st := &taskStats{Name: name}
+		st.Succeeded, st.Failed = s.values(now)
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func (m *Monitor) runningTasks() []*workerTasks {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workers := make([]*workerTasks, 0, len(m.running))
+	for worker, tasks := range m.running {
+		wt := &workerTasks{Worker: worker}
+		for _, t := range tasks {
+			c := *t
+			wt.Tasks = append(wt.Tasks, &c)
+		}
+		sort.Slice(wt.Tasks, func(i, j int) bool {
+			return wt.Tasks[i].Started.Before(wt.Tasks[j].Started)
+		})
+		workers = append(workers, wt)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].Worker < workers[j].Worker
+	})
+	return workers
+}
+
+func (m *Monitor) minute() int64 {
+	return m.now().Unix() / 60
+}
+
+func (s *series) add(minute int64, failed bool) {
+	i := minute % statsWindow
+	if s.minutes[i] != minute {
+		s.minutes[i], s.succeeded[i], s.failed[i] = minute, 0, 0
+	}
+	if failed {
+		s.failed[i]++
+	} else {
+		s.succeeded[i]++
+	}
+}
+
+func (s *series) values(now int64) ([]int64, []int64) {
+	succeeded, failed := make([]int64, statsWindow), make([]int64, statsWindow)
+	for k := 0; k < statsWindow; k++ {
+		minute := now - statsWindow + 1 + int64(k)
+		if i := minute % statsWindow; s.minutes[i] == minute {
+			succeeded[k], failed[k] = s.succeeded[i], s.failed[i]
+		}
+	}
+	return succeeded, failed
+}
@@ -0,0 +1,63 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/task"
+)
+
+func TestMonitor(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Unix(1700000000, 0)
+	m := NewMonitor()
+	m.now = func() time.Time { return now }
+
+	t1, t2 := task.NewTask(nil, "add"), task.NewTask(nil, "add")
+	m.Observe(asq.Event{Kind: asq.EventStarted, Task: t1, Worker: "w1"})
+	m.Observe(asq.Event{Kind: asq.EventStarted, Task: t2, Worker: "w1"})
+	running := m.runningTasks()
+	is.Equal(len(running), 1)
+	is.Equal(len(running[0].Tasks), 2)
+
+	m.Observe(asq.Event{Kind: asq.EventSucceeded, Task: t1, Worker: "w1"})
+	now = now.Add(time.Minute)
+	m.Observe(asq.Event{Kind: asq.EventFailed, Task: t2, Worker: "w1", Err: errors.New("failed")})
+	is.Equal(len(m.runningTasks()), 0)
+
+	stats := m.stats()
+	is.Equal(len(stats), 1)
+	is.Equal(stats[0].Succeeded[statsWindow-2:], []int64{1, 0})
+	is.Equal(stats[0].Failed[statsWindow-2:], []int64{0, 1})
+
+	// 超出时间窗口的计数被淘汰
+	now = now.Add(statsWindow * time.Minute)
+	is.Equal(m.stats()[0].Succeeded, make([]int64, statsWindow))
+}
+
+func TestDashboard(t *testing.T) {
+	is := is.New(t)
+
+	broker := &fakeBroker{revoked: make(map[string]bool)}
+	h := NewDashboard(NewMonitor(), asq.NewApp(broker, nopBackend{}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	is.Equal(rec.Code, http.StatusOK)
+	is.True(strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html"))
+	is.True(strings.Contains(rec.Body.String(), "<title>asq</title>"))
+
+	var stats []taskStats
+	is.Equal(do(t, h, "GET", "/stats", &stats), http.StatusOK)
+	is.Equal(do(t, h, "GET", "/queues/default", nil), http.StatusOK)
+
+	// 没有 Monitor 时不提供统计
+	is.Equal(do(t, NewDashboard(nil, asq.NewApp(broker, nopBackend{})), "GET", "/stats", nil), http.StatusNotFound)
+}
@@ -2,34 +2,102 @@ package asq
 
 import (
 	"context"
+	"io"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/google/uuid"
+	"github.com/zigzed/asq/control"
+	"github.com/zigzed/asq/log"
+	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/redact"
 	"github.com/zigzed/asq/redis"
+	"github.com/zigzed/asq/registry"
 	"github.com/zigzed/asq/task"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type App struct {
-	mgr     *fnManager
-	broker  Broker
-	backend Backend
-	logger  Logger
+	mgr        *fnManager
+	broker     Broker
+	backend    Backend
+	logger     Logger
+	invoker    Invoker
+	marshaller marshaller.Marshaller
+
+	interceptors       []Interceptor
+	submitInterceptors []SubmitInterceptor
+	tracer             trace.Tracer
+	propagator         propagation.TextMapPropagator
+	listeners          []Listener
+	states             StateStore
+	registry           registry.Registry
+	control            control.Transport
+	deadLetters        bool
 }
 
 type Options func(*App)
 
+// WithLogger sets the logger of the app, its workers pass it to the invoker.
+// The packages not bound to an app log with log.Default(), see
+// log.SetDefault.
 func WithLogger(logger Logger) Options {
 	return func(app *App) {
 		app.logger = logger
 	}
 }
 
+// WithInvoker sets the invoker of registered functions, it takes precedence
+// over the stubs generated by asqgen. WithHandlerInvoker overrides it.
+func WithInvoker(vk Invoker) Options {
+	return func(app *App) {
+		app.invoker = vk
+	}
+}
+
+// WithMarshaller tells the app which marshaller the broker and backend use,
+// so that Register can check it against the invoker.
+func WithMarshaller(m marshaller.Marshaller) Options {
+	return func(app *App) {
+		app.marshaller = m
+	}
+}
+
+// WithDeadLetters keeps the tasks given up after all retries in the broker,
+// if it implements DeadLetterer. NewAppFromRedis enables it with
+// redis.Option.DeadLetterLen.
+func WithDeadLetters() Options {
+	return func(app *App) {
+		app.deadLetters = true
+	}
+}
+
+type RegisterOptions func(*fnHandler)
+
+// WithHandlerInvoker overrides the app invoker for a single function.
+func WithHandlerInvoker(vk Invoker) RegisterOptions {
+	return func(h *fnHandler) {
+		h.invoker = vk
+	}
+}
+
+// WithRateLimit limits the executions of the function to rate per second on
+// each worker, it can be changed at runtime by the rate_limit command.
+func WithRateLimit(rate float64) RegisterOptions {
+	return func(h *fnHandler) {
+		h.rate = rate
+	}
+}
+
 func NewApp(broker Broker, backend Backend, opts ...Options) *App {
 	app := &App{
-		mgr:     newFnManager(),
-		broker:  broker,
-		backend: backend,
-		logger:  defaultLogger{},
+		mgr:        newFnManager(),
+		broker:     broker,
+		backend:    backend,
+		logger:     log.Default(),
+		tracer:     defaultTracer(),
+		propagator: propagation.TraceContext{},
 	}
 	for _, opt := range opts {
 		opt(app)
@@ -38,25 +106,115 @@ func NewApp(broker Broker, backend Backend, opts ...Options) *App {
 }
 
 func NewAppFromRedis(cfg redis.Option, queue string, opts ...Options) (*App, error) {
+	opts = append([]Options{WithMarshaller(cfg.Marshaller)}, opts...)
+	app := NewApp(nil, nil, opts...)
+	if cfg.Logger == nil {
+		cfg.Logger = app.logger
+	}
+
 	broker, err := redis.NewBroker(&cfg, queue)
 	if err != nil {
 		return nil, err
 	}
 	backend, err := redis.NewBackend(&cfg, queue)
 	if err != nil {
+		broker.Close()
 		return nil, err
 	}
+	// 失败时关闭已经创建的连接
+	closers := []io.Closer{broker, backend}
+	if app.registry == nil && cfg.Registry {
+		reg, err := redis.NewRegistry(&cfg)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		app.registry = reg
+		closers = append(closers, reg)
+	}
 
-	return NewApp(broker, backend, opts...), nil
+	if app.control == nil && cfg.Control {
+		ctl, err := redis.NewControl(&cfg, queue)
+		if err != nil {
+			closeAll(closers)
+			return nil, err
+		}
+		app.control = ctl
+	}
+
+	app.broker, app.backend = broker, backend
+	if cfg.StateTTL > 0 {
+		WithStateStore(backend)(app)
+	}
+	if cfg.DeadLetterLen > 0 {
+		WithDeadLetters()(app)
+	}
+	return app, nil
 }
 
-func (app *App) Register(name string, fn interface{}) error {
-	return app.mgr.register(name, fn)
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		c.Close()
+	}
+}
+
+// Broker returns the broker of the app, e.g. to check it for the optional
+// interfaces like DeadLetterer.
+func (app *App) Broker() Broker {
+	return app.broker
+}
+
+func (app *App) Backend() Backend {
+	return app.backend
+}
+
+// Logger returns the logger of the app, set by WithLogger.
+func (app *App) Logger() Logger {
+	return app.logger
+}
+
+func (app *App) Register(name string, fn interface{}, opts ...RegisterOptions) error {
+	h := &fnHandler{fn: fn, params: paramTypes(fn)}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	vk := h.invoker
+	if vk == nil {
+		vk = app.invoker
+	}
+	// 未指定 marshaller 时按 redis 默认的 JSON 检查
+	m := app.marshaller
+	if m == nil {
+		m = marshaller.NewJsonMarshaller()
+	}
+	if err := checkInvoker(vk, m); err != nil {
+		return errors.Wrapf(err, "register function %s failed", name)
+	}
+
+	return app.mgr.register(name, h)
+}
+
+// RedactArgs formats the args of t for logs like the workers of the app, the
+// decoded args are masked by the tags of the parameters of the function
+// registered for t.
+func (app *App) RedactArgs(t *task.Task) string {
+	return redact.ArgsAs(t.Name, t.Args, app.mgr.params(t.Name))
 }
 
 func (app *App) StartWorker(ctx context.Context, size int) {
-	worker := newWorker(app.broker, app.backend, app.mgr, app.logger)
-	worker.Start(ctx, size)
+	app.newWorker().Start(ctx, size)
+}
+
+func (app *App) newWorker() *Worker {
+	w := newWorker(app.broker, app.backend, app.mgr, app.logger, app.invoker)
+	w.interceptors = app.interceptors
+	w.tracer, w.propagator = app.tracer, app.propagator
+	w.listeners = app.listeners
+	w.registry = app.registry
+	w.control = app.control
+	w.deadLetters = app.deadLetters
+	return w
 }
 
 func (app *App) SubmitTask(ctx context.Context, tasks ...*task.Task) (*AsyncResult, error) {
@@ -67,9 +225,22 @@ func (app *App) SubmitTask(ctx context.Context, tasks ...*task.Task) (*AsyncResu
 	}
 
 	task := app.makeTaskLink(tasks...)
-	if err := app.broker.Push(ctx, task); err != nil {
-		return nil, errors.Wrapf(err, "push task %v failed", tasks)
+	ctx, span := app.tracer.Start(ctx, "asq.submit "+task.Name,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(taskAttributes(task)...))
+	defer span.End()
+
+	app.propagator.Inject(ctx, headerCarrier{task})
+	for _, x := range task.OnSuccess {
+		x.InheritHeaders(task)
+	}
+	task.SubmittedAt = time.Now().UnixMilli()
+	push := chainSubmitInterceptors(app.submitInterceptors, app.broker.Push)
+	if err := push(ctx, task); err != nil {
+		recordError(span, err)
+		return nil, errors.Wrapf(err, "push task %s failed", redact.TaskAs(task, app.mgr.params(task.Name)))
 	}
+	emit(app.listeners, Event{Kind: EventSubmitted, Task: task})
 
 	if len(tasks) > 0 {
 		task := tasks[len(tasks)-1]
@@ -0,0 +1,21 @@
+// Package blob stores large task args and results outside of the broker, the
+// broker message only carries a reference to the blob (claim check).
+package blob
+
+import (
+	"context"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// ErrNotFound is returned by Get for missing or expired blobs.
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps the payloads, a blob is removed after its ttl even if nobody
+// deletes it. A zero ttl keeps the blob until it is deleted.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, ttl time.Duration) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
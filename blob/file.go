@@ -0,0 +1,174 @@
+package blob
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+// 过期时间保存在文件的修改时间中，Put 时顺便清理过期的文件
+const sweepPeriod = time.Minute
+
+// 不过期的 blob 的修改时间设置为 100 年以后
+const noExpiry = 100 * 365 * 24 * time.Hour
+
+// 写入中的临时文件名为 .tmp-<创建的 unix 秒>-*，超过 tmpGrace 的是崩溃遗留的
+const (
+	tmpPrefix = ".tmp-"
+	tmpGrace  = time.Hour
+)
+
+// FileStore stores blobs as files in a directory shared by producers and
+// workers, e.g. a network file system.
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "create blob directory %s failed", dir)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (fs *FileStore) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(fs.dir, tmpPrefix+strconv.FormatInt(time.Now().Unix(), 10)+"-*")
+	if err != nil {
+		return errors.Wrapf(err, "create blob %s failed", key)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrapf(err, "write blob %s failed", key)
+	}
+	if ttl == 0 {
+		ttl = noExpiry
+	}
+	expired := time.Now().Add(ttl)
+	if err := os.Chtimes(tmp.Name(), expired, expired); err != nil {
+		return errors.Wrapf(err, "set ttl of blob %s failed", key)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "write blob %s failed", key)
+	}
+
+	fs.sweep()
+	return nil
+}
+
+func (fs *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := fs.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && fi.ModTime().Before(time.Now())) {
+		return nil, errors.Wrapf(ErrNotFound, "blob %s", key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read blob %s failed", key)
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "blob %s", key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "read blob %s failed", key)
+	}
+	return data, nil
+}
+
+func (fs *FileStore) Delete(ctx context.Context, key string) error {
+	path, err := fs.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "delete blob %s failed", key)
+	}
+	return nil
+}
+
+// Sweep removes the expired blobs, and the temporary files left by writers
+// crashed an hour ago.
+func (fs *FileStore) Sweep() error {
+	entries, err := os.ReadDir(fs.dir)
+	if err != nil {
+		return errors.Wrapf(err, "read blob directory %s failed", fs.dir)
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), tmpPrefix) {
+			if created, ok := tmpCreated(e); ok && now.Sub(created) > tmpGrace {
+				os.Remove(filepath.Join(fs.dir, e.Name()))
+			}
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil || !fi.ModTime().Before(now) {
+			continue
+		}
+		os.Remove(filepath.Join(fs.dir, e.Name()))
+	}
+	return nil
+}
+
+// tmpCreated returns the time the temporary file is created at. The ttl is set
+// as its modification time before the rename, so the time is kept in the name,
+// the modification time is used for the files without it.
+func tmpCreated(e os.DirEntry) (time.Time, bool) {
+	name := e.Name()[len(tmpPrefix):]
+	if i := strings.IndexByte(name, '-'); i > 0 {
+		if sec, err := strconv.ParseInt(name[:i], 10, 64); err == nil {
+			return time.Unix(sec, 0), true
+		}
+	}
+	fi, err := e.Info()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
+
+func (fs *FileStore) sweep() {
+	fs.mu.Lock()
+	if time.Since(fs.swept) < sweepPeriod {
+		fs.mu.Unlock()
+		return
+	}
+	fs.swept = time.Now()
+	fs.mu.Unlock()
+
+	go fs.Sweep()
+}
+
+func (fs *FileStore) path(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, ".") {
+		return "", errors.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(fs.dir, key), nil
+}
@@ -0,0 +1,71 @@
+package blob
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+)
+
+func TestFileStore(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	fs, err := NewFileStore(t.TempDir())
+	is.NoErr(err)
+
+	is.NoErr(fs.Put(ctx, "a", []byte("hello"), time.Minute))
+	data, err := fs.Get(ctx, "a")
+	is.NoErr(err)
+	is.Equal(string(data), "hello")
+
+	is.NoErr(fs.Delete(ctx, "a"))
+	_, err = fs.Get(ctx, "a")
+	is.True(errors.Is(err, ErrNotFound))
+	is.NoErr(fs.Delete(ctx, "a"))
+
+	// 过期的 blob 读不到，并且会被清理
+	is.NoErr(fs.Put(ctx, "b", []byte("hello"), -time.Second))
+	_, err = fs.Get(ctx, "b")
+	is.True(errors.Is(err, ErrNotFound))
+	is.NoErr(fs.Sweep())
+	_, err = os.Stat(filepath.Join(fs.dir, "b"))
+	is.True(os.IsNotExist(err))
+
+	// ttl 为 0 的 blob 不过期
+	is.NoErr(fs.Put(ctx, "d", []byte("hello"), 0))
+	is.NoErr(fs.Sweep())
+	data, err = fs.Get(ctx, "d")
+	is.NoErr(err)
+	is.Equal(string(data), "hello")
+
+	// 崩溃遗留的临时文件超过 tmpGrace 后被清理，写入中的保留
+	old := time.Now().Add(-2 * tmpGrace)
+	stale := filepath.Join(fs.dir, tmpPrefix+strconv.FormatInt(old.Unix(), 10)+"-1")
+	renaming := filepath.Join(fs.dir, tmpPrefix+strconv.FormatInt(old.Unix(), 10)+"-2")
+	legacy := filepath.Join(fs.dir, tmpPrefix+"3")
+	writing := filepath.Join(fs.dir, tmpPrefix+strconv.FormatInt(time.Now().Unix(), 10)+"-4")
+	for _, name := range []string{stale, renaming, legacy, writing} {
+		is.NoErr(os.WriteFile(name, []byte("x"), 0600))
+	}
+	// 设置了 ttl 但没有 rename 的临时文件按文件名中的时间清理
+	future := time.Now().Add(noExpiry)
+	is.NoErr(os.Chtimes(renaming, future, future))
+	is.NoErr(os.Chtimes(legacy, old, old))
+	is.NoErr(fs.Sweep())
+	for _, name := range []string{stale, renaming, legacy} {
+		_, err = os.Stat(name)
+		is.True(os.IsNotExist(err))
+	}
+	_, err = os.Stat(writing)
+	is.NoErr(err)
+
+	is.Err(fs.Put(ctx, "../c", nil, time.Minute))
+	_, err = fs.Get(ctx, ".hidden")
+	is.Err(err)
+}
@@ -11,3 +11,28 @@ type Broker interface {
 	Push(ctx context.Context, task *task.Task) error
 	Poll(ctx context.Context, timeout time.Duration) (*task.Task, error)
 }
+
+// DeadLetterer is implemented by brokers keeping the tasks given up after all
+// retries, so they can be inspected or requeued.
+type DeadLetterer interface {
+	DeadLetter(ctx context.Context, task *task.Task, reason error) error
+}
+
+// Revoker is implemented by brokers supporting revoked tasks, the worker drops
+// them instead of executing.
+type Revoker interface {
+	Revoked(ctx context.Context, id string) (bool, error)
+}
+
+// Inspector is implemented by brokers which can be inspected without
+// consuming the tasks, like the redis broker. App exposes it, see App.Len.
+type Inspector interface {
+	// Len returns the number of tasks waiting to be polled
+	Len(ctx context.Context) (int64, error)
+	// DelayedLen returns the number of tasks scheduled for later
+	DelayedLen(ctx context.Context) (int64, error)
+	// Peek returns the waiting tasks from the next one to be polled
+	Peek(ctx context.Context, offset, count int64) ([]*task.Task, error)
+	// Purge deletes the waiting tasks and returns their number
+	Purge(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/blob"
+	"github.com/zigzed/asq/control"
+	"github.com/zigzed/asq/redact"
+	"github.com/zigzed/asq/redis"
+	"github.com/zigzed/asq/registry"
+	"github.com/zigzed/asq/task"
+)
+
+// 分页读取队列的大小
+const pageSize = 500
+
+// brokerClient is the part of the redis broker used by the commands.
+type brokerClient interface {
+	asq.Broker
+	asq.Inspector
+	DeadLen(ctx context.Context) (int64, error)
+	Paused(ctx context.Context) (bool, error)
+	PeekDelayed(ctx context.Context, offset, count int64) ([]*task.Task, error)
+	DeadLetters(ctx context.Context, offset, count int64) ([]*task.Task, error)
+	Reschedule(ctx context.Context, id string, at time.Time) (bool, error)
+	PurgeDelayed(ctx context.Context) (int64, error)
+	PurgeDead(ctx context.Context) (int64, error)
+	Close() error
+}
+
+type backendClient interface {
+	asq.Backend
+	asq.StateStore
+	WatchStates(ctx context.Context, fn func(st *task.State)) error
+	Close() error
+}
+
+type client struct {
+	broker   brokerClient
+	backend  backendClient
+	registry registry.Registry
+	control  control.Transport
+	app      *asq.App
+	out      io.Writer
+}
+
+func dial(opt *redis.Option, queue string) (*client, error) {
+	broker, err := redis.NewBroker(opt, queue)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := redis.NewBackend(opt, queue)
+	if err != nil {
+		broker.Close()
+		return nil, err
+	}
+	reg, err := redis.NewRegistry(opt)
+	if err != nil {
+		broker.Close()
+		backend.Close()
+		return nil, err
+	}
+	ctl, err := redis.NewControl(opt, queue)
+	if err != nil {
+		broker.Close()
+		backend.Close()
+		reg.Close()
+		return nil, err
+	}
+	return &client{
+		broker:   broker,
+		backend:  backend,
+		registry: reg,
+		control:  ctl,
+		app: asq.NewApp(broker, backend, asq.WithMarshaller(opt.Marshaller),
+			asq.WithStateStore(backend), asq.WithControl(ctl)),
+		out: os.Stdout,
+	}, nil
+}
+
+func (c *client) Close() {
+	c.broker.Close()
+	c.backend.Close()
+	for _, x := range []interface{}{c.registry, c.control} {
+		if x, ok := x.(interface{ Close() error }); ok {
+			x.Close()
+		}
+	}
+}
+
+func setBlobStore(opt *redis.Option, dir string, useRedis bool) error {
+	switch {
+	case dir != "":
+		store, err := blob.NewFileStore(dir)
+		if err != nil {
+			return err
+		}
+		opt.BlobStore = store
+	case useRedis:
+		store, err := redis.NewBlobStore(opt)
+		if err != nil {
+			return err
+		}
+		opt.BlobStore = store
+	}
+	return nil
+}
+
+func runEnqueue(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("enqueue")
+	var (
+		retry   = fs.Int("retry", 0, "retry count")
+		backoff = fs.Duration("backoff", time.Second, "delay before the first retry")
+		at      = fs.String("at", "", "run at an RFC 3339 time or after a duration like 10m")
+		ignore  = fs.Bool("ignore-result", false, "the worker does not keep the result")
+		expire  = fs.Duration("result-expired", 15*time.Second, "time the result is kept")
+		wait    = fs.Duration("wait", 0, "wait for the final state of the task")
+		headers = headerFlag{}
+	)
+	fs.Var(headers, "header", "key=value header of the task, repeatable")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return fmt.Errorf("enqueue needs a task name and optional json args")
+	}
+
+	opt := task.NewTaskOption(*retry, *backoff).
+		WithIgnoreResult(*ignore).
+		WithResultExpired(*expire)
+	if *at != "" {
+		eta, err := parseTime(*at, time.Now())
+		if err != nil {
+			return err
+		}
+		opt.WithStartAt(eta)
+	}
+	t, err := newTask(opt, fs.Arg(0), fs.Arg(1), headers)
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.app.SubmitTask(ctx, t); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, t.Id)
+	if *wait > 0 {
+		return c.wait(ctx, t.Id, *wait)
+	}
+	return nil
+}
+
+// newTask decodes the args from a json array, numbers are float64 as with
+// the json marshaller.
+func newTask(opt *task.TaskOption, name, args string, headers map[string]string) (*task.Task, error) {
+	var values []interface{}
+	if args != "" {
+		if err := json.Unmarshal([]byte(args), &values); err != nil {
+			return nil, fmt.Errorf("args of %s must be a json array: %v", name, err)
+		}
+	}
+	t := task.NewTask(opt, name, values...)
+	for k, v := range headers {
+		t.SetHeader(k, v)
+	}
+	return t, nil
+}
+
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	return fmt.Sprint(map[string]string(h))
+}
+
+func (h headerFlag) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return fmt.Errorf("header %q is not key=value", s)
+	}
+	h[s[:i]] = s[i+1:]
+	return nil
+}
+
+func runWait(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("wait")
+	timeout := fs.Duration("timeout", time.Minute, "time to wait")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("wait needs a task id")
+	}
+	return c.wait(ctx, fs.Arg(0), *timeout)
+}
+
+// wait polls the recorded state instead of the result, so the result is
+// left to the producer waiting for it.
+func (c *client) wait(ctx context.Context, id string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tick := time.NewTicker(500 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		st, err := c.backend.State(ctx, id)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+		if st != nil && finished(st.Status) {
+			printState(c.out, st)
+			if st.Status != task.StatusSucceeded {
+				return fmt.Errorf("task %s %s", id, st.Status)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if st == nil {
+				return fmt.Errorf("no state of task %s, are the task states recorded?", id)
+			}
+			return fmt.Errorf("task %s still %s", id, st.Status)
+		case <-tick.C:
+		}
+	}
+}
+
+// finished reports the states after which the task won't run again.
+func finished(s task.Status) bool {
+	switch s {
+	case task.StatusSucceeded, task.StatusDeadLettered, task.StatusRevoked, task.StatusGivenUp:
+		return true
+	}
+	return false
+}
+
+func printState(w io.Writer, st *task.State) {
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\tattempts=%d", time.UnixMilli(st.Updated).Format(time.RFC3339), st.Status, st.Name, st.Id, st.Attempts)
+	if st.Worker != "" {
+		fmt.Fprintf(w, "\tworker=%s", st.Worker)
+	}
+	if st.Results != "" {
+		fmt.Fprintf(w, "\tresults=%s", st.Results)
+	}
+	if st.Error != "" {
+		fmt.Fprintf(w, "\terror=%q", st.Error)
+	}
+	fmt.Fprintln(w)
+}
+
+func runInspect(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("inspect")
+	count := fs.Int64("count", 10, "number of waiting tasks to print")
+	fs.Parse(args)
+
+	pending, err := c.broker.Len(ctx)
+	if err != nil {
+		return err
+	}
+	delayed, err := c.broker.DelayedLen(ctx)
+	if err != nil {
+		return err
+	}
+	dead, err := c.broker.DeadLen(ctx)
+	if err != nil {
+		return err
+	}
+	paused, err := c.broker.Paused(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "pending=%d delayed=%d dead=%d paused=%v\n", pending, delayed, dead, paused)
+
+	tasks, err := c.broker.Peek(ctx, 0, *count)
+	if err != nil {
+		return err
+	}
+	printTasks(c.out, tasks, false)
+	return nil
+}
+
+func runPurge(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("purge")
+	var (
+		pending = fs.Bool("pending", true, "purge the waiting tasks")
+		delayed = fs.Bool("delayed", false, "purge the delayed tasks")
+		dead    = fs.Bool("dead", false, "purge the dead lettered tasks")
+		yes     = fs.Bool("yes", false, "confirm the purge")
+	)
+	fs.Parse(args)
+	if !*yes {
+		return fmt.Errorf("purge deletes the tasks, confirm with -yes")
+	}
+
+	purges := []struct {
+		enabled bool
+		name    string
+		purge   func(context.Context) (int64, error)
+	}{
+		{*pending, "pending", c.broker.Purge},
+		{*delayed, "delayed", c.broker.PurgeDelayed},
+		{*dead, "dead", c.broker.PurgeDead},
+	}
+	for _, p := range purges {
+		if !p.enabled {
+			continue
+		}
+		n, err := p.purge(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "%s: %d purged\n", p.name, n)
+	}
+	return nil
+}
+
+func runDelayed(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("delayed")
+	offset := fs.Int64("offset", 0, "number of tasks to skip")
+	count := fs.Int64("count", 50, "number of tasks to print")
+	fs.Parse(args)
+
+	tasks, err := c.broker.PeekDelayed(ctx, *offset, *count)
+	if err != nil {
+		return err
+	}
+	printTasks(c.out, tasks, true)
+	return nil
+}
+
+func runReschedule(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("reschedule")
+	at := fs.String("at", "", "new time, RFC 3339 or a duration from now like 10m")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *at == "" {
+		fs.Usage()
+		return fmt.Errorf("reschedule needs a task id and -at")
+	}
+
+	eta, err := parseTime(*at, time.Now())
+	if err != nil {
+		return err
+	}
+	found, err := c.broker.Reschedule(ctx, fs.Arg(0), eta)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("delayed task %s not found", fs.Arg(0))
+	}
+	fmt.Fprintf(c.out, "%s rescheduled at %s\n", fs.Arg(0), eta.Format(time.RFC3339))
+	return nil
+}
+
+func printTasks(w io.Writer, tasks []*task.Task, due bool) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, t := range tasks {
+		at := ""
+		if due && t.Option.StartAt != nil {
+			at = time.UnixMilli(*t.Option.StartAt).Format(time.RFC3339)
+		} else if t.SubmittedAt != 0 {
+			at = time.UnixMilli(t.SubmittedAt).Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", t.Id, t.Name, at, redact.Args(t.Name, t.Args))
+	}
+	tw.Flush()
+}
+
+func runTail(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("tail")
+	asJSON := fs.Bool("json", false, "print the states as JSON lines")
+	fs.Parse(args)
+
+	enc := json.NewEncoder(c.out)
+	return c.backend.WatchStates(ctx, func(st *task.State) {
+		if *asJSON {
+			enc.Encode(st)
+		} else {
+			printState(c.out, st)
+		}
+	})
+}
+
+func runWorkers(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("workers")
+	fs.Parse(args)
+
+	workers, err := c.registry.Workers(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for _, w := range workers {
+		status := "alive"
+		if !w.Alive(now) {
+			status = "dead"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s:%d\t%s\tconcurrency=%d\trunning=%d\theartbeat=%s ago\n",
+			w.Id, status, w.Hostname, w.Pid, strings.Join(w.Queues, ","), w.Concurrency, len(w.Running),
+			now.Sub(w.Heartbeat).Truncate(time.Second))
+	}
+	return tw.Flush()
+}
+
+func runControl(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("control")
+	var (
+		timeout = fs.Duration("timeout", time.Second, "time to wait for the replies")
+		workers = fs.String("workers", "", "comma separated worker ids, all the workers if empty")
+	)
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("control needs a command: ping, stats, pause, resume, concurrency n, rate_limit task rate or shutdown")
+	}
+
+	var ids []string
+	if *workers != "" {
+		ids = strings.Split(*workers, ",")
+	}
+	cmd, err := newCommand(fs.Args(), ids)
+	if err != nil {
+		return err
+	}
+	replies, err := c.app.Broadcast(ctx, cmd, *timeout)
+	if err != nil {
+		return err
+	}
+	if len(replies) == 0 {
+		return fmt.Errorf("no reply in %v", *timeout)
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for _, r := range replies {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(tw, "%s\terror: %s\n", r.Worker, r.Error)
+		case r.Stats != nil:
+			st := r.Stats
+			fmt.Fprintf(tw, "%s\tconcurrency=%d\tpaused=%v\trunning=%d\tsucceeded=%d\tfailed=%d\trate_limits=%v\tuptime=%s\n",
+				r.Worker, st.Concurrency, st.Paused, st.Running, st.Succeeded, st.Failed, st.RateLimits,
+				time.Since(st.Started).Truncate(time.Second))
+		default:
+			fmt.Fprintf(tw, "%s\tok\n", r.Worker)
+		}
+	}
+	return tw.Flush()
+}
+
+// newCommand parses the command name and its arguments.
+func newCommand(args []string, workers []string) (*control.Command, error) {
+	name, args := args[0], args[1:]
+	want := 0
+	switch name {
+	case control.Concurrency:
+		want = 1
+	case control.RateLimit:
+		want = 2
+	case control.Ping, control.Stats, control.Pause, control.Resume, control.Shutdown:
+	default:
+		return nil, fmt.Errorf("unknown control command %s", name)
+	}
+	if len(args) != want {
+		return nil, fmt.Errorf("%s needs %d arguments", name, want)
+	}
+
+	switch name {
+	case control.Concurrency:
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid concurrency %s", args[0])
+		}
+		return control.SetConcurrency(n, workers...), nil
+	case control.RateLimit:
+		rate, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %s", args[1])
+		}
+		return control.SetRateLimit(args[0], rate, workers...), nil
+	}
+	return &control.Command{Name: name, Workers: workers}, nil
+}
+
+func runExport(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("export")
+	from := fs.String("from", "tasks", "tasks, delayed or dead")
+	output := fs.String("o", "", "output file, stdout if empty")
+	fs.Parse(args)
+
+	var peek func(ctx context.Context, offset, count int64) ([]*task.Task, error)
+	switch *from {
+	case "tasks":
+		peek = c.broker.Peek
+	case "delayed":
+		peek = c.broker.PeekDelayed
+	case "dead":
+		peek = c.broker.DeadLetters
+	default:
+		return fmt.Errorf("unknown queue %s, tasks, delayed or dead", *from)
+	}
+
+	w := c.out
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	n, err := exportTasks(ctx, w, peek)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d tasks exported\n", n)
+	return nil
+}
+
+// exportTasks writes the tasks as JSON lines, in their order in the queue.
+// Tasks pushed or polled meanwhile may be missed or written twice.
+func exportTasks(ctx context.Context, w io.Writer, peek func(ctx context.Context, offset, count int64) ([]*task.Task, error)) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	n := 0
+	for offset := int64(0); ; offset += pageSize {
+		tasks, err := peek(ctx, offset, pageSize)
+		if err != nil {
+			return n, err
+		}
+		for _, t := range tasks {
+			if err := enc.Encode(t); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if len(tasks) < pageSize {
+			break
+		}
+	}
+	return n, bw.Flush()
+}
+
+func runImport(ctx context.Context, c *client, args []string) error {
+	fs := newFlagSet("import")
+	newIds := fs.Bool("new-ids", false, "give the tasks new ids instead of the exported ones")
+	fs.Parse(args)
+
+	r := io.Reader(os.Stdin)
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := importTasks(ctx, r, func(ctx context.Context, t *task.Task) error {
+		if *newIds {
+			t.Id = ""
+		}
+		_, err := c.app.SubmitTask(ctx, t)
+		return err
+	})
+	fmt.Fprintf(os.Stderr, "%d tasks imported\n", n)
+	return err
+}
+
+// importTasks pushes the tasks read from JSON lines, it stops at the first
+// error.
+func importTasks(ctx context.Context, r io.Reader, push func(ctx context.Context, t *task.Task) error) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var t task.Task
+		if err := dec.Decode(&t); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("decode task %d: %v", n+1, err)
+		}
+		if t.Name == "" {
+			return n, fmt.Errorf("task %d has no name", n+1)
+		}
+		if err := push(ctx, &t); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/control"
+	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/task"
+)
+
+func TestNewTask(t *testing.T) {
+	is := is.New(t)
+
+	t1, err := newTask(task.NewTaskOption(0, time.Second), "add", `[1, "a", {"k": true}]`,
+		map[string]string{"request-id": "r1"})
+	is.NoErr(err)
+	is.Equal(t1.Args, []interface{}{1.0, "a", map[string]interface{}{"k": true}})
+	is.Equal(t1.Headers["request-id"], "r1")
+
+	_, err = newTask(nil, "add", `{"a": 1}`, nil)
+	is.Err(err)
+
+	h := headerFlag{}
+	is.NoErr(h.Set("a=b=c"))
+	is.Equal(h["a"], "b=c")
+	is.Err(h.Set("=b"))
+}
+
+func TestParseTime(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	at, err := parseTime("10m", now)
+	is.NoErr(err)
+	is.Equal(at, now.Add(10*time.Minute))
+
+	at, err = parseTime("2024-01-02T04:00:00Z", now)
+	is.NoErr(err)
+	is.Equal(at, time.Date(2024, 1, 2, 4, 0, 0, 0, time.UTC))
+
+	_, err = parseTime("tomorrow", now)
+	is.Err(err)
+}
+
+// memStates 只实现 wait 用到的 State
+type memStates struct {
+	backendClient
+	states map[string]*task.State
+}
+
+func (ms *memStates) State(ctx context.Context, id string) (*task.State, error) {
+	return ms.states[id], nil
+}
+
+func TestWait(t *testing.T) {
+	is := is.New(t)
+
+	var out bytes.Buffer
+	c := &client{backend: &memStates{states: map[string]*task.State{
+		"t1": {Id: "t1", Name: "fail", Status: task.StatusGivenUp, Attempts: 3},
+		"t2": {Id: "t2", Name: "fail", Status: task.StatusFailed, Attempts: 1},
+	}}, out: &out}
+
+	// 没有死信队列时最后的状态是 given_up，不等到超时
+	start := time.Now()
+	err := c.wait(context.Background(), "t1", time.Minute)
+	is.Err(err)
+	is.True(strings.Contains(err.Error(), "given_up"))
+	is.True(time.Since(start) < time.Second)
+	is.True(strings.Contains(out.String(), "given_up"))
+
+	// 还会重试的失败继续等待
+	err = c.wait(context.Background(), "t2", 100*time.Millisecond)
+	is.Err(err)
+	is.True(strings.Contains(err.Error(), "still failed"))
+}
+
+func TestWrapMarshaller(t *testing.T) {
+	is := is.New(t)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	cm, err := marshaller.NewCompressMarshaller(marshaller.NewJsonMarshaller(), marshaller.CompressZstd, 16)
+	is.NoErr(err)
+	workers, err := marshaller.NewEncryptMarshaller(cm, "k1", map[string][]byte{"k1": key})
+	is.NoErr(err)
+	buf, err := workers.EncodeTask(task.NewTask(nil, "echo", strings.Repeat("x", 100)))
+	is.NoErr(err)
+
+	m, err := wrapMarshaller(marshaller.NewJsonMarshaller(), "zstd",
+		"k2:"+base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))+
+			",k1:"+base64.StdEncoding.EncodeToString(key))
+	is.NoErr(err)
+	t1, err := m.DecodeTask(buf)
+	is.NoErr(err)
+	is.Equal(t1.Name, "echo")
+
+	// 缺少密钥时解码失败
+	m, err = wrapMarshaller(marshaller.NewJsonMarshaller(), "zstd", "")
+	is.NoErr(err)
+	_, err = m.DecodeTask(buf)
+	is.Err(err)
+
+	_, err = wrapMarshaller(marshaller.NewJsonMarshaller(), "lz4", "")
+	is.Err(err)
+	_, err = wrapMarshaller(marshaller.NewJsonMarshaller(), "", "k1")
+	is.Err(err)
+	_, err = wrapMarshaller(marshaller.NewJsonMarshaller(), "", "k1:short")
+	is.Err(err)
+}
+
+func TestNewCommand(t *testing.T) {
+	is := is.New(t)
+
+	cmd, err := newCommand([]string{"rate_limit", "send", "2.5"}, []string{"w1"})
+	is.NoErr(err)
+	is.Equal(cmd, control.SetRateLimit("send", 2.5, "w1"))
+
+	cmd, err = newCommand([]string{"concurrency", "8"}, nil)
+	is.NoErr(err)
+	is.Equal(cmd.Concurrency, 8)
+
+	cmd, err = newCommand([]string{"ping"}, nil)
+	is.NoErr(err)
+	is.Equal(cmd.Name, control.Ping)
+
+	_, err = newCommand([]string{"concurrency"}, nil)
+	is.Err(err)
+	_, err = newCommand([]string{"reboot"}, nil)
+	is.Err(err)
+}
+
+func TestExportImport(t *testing.T) {
+	is := is.New(t)
+
+	var queue []*task.Task
+	for i := 0; i < pageSize+3; i++ {
+		queue = append(queue, task.NewTask(nil, "add", float64(i), 1.0))
+	}
+	peek := func(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+		if offset >= int64(len(queue)) {
+			return nil, nil
+		}
+		end := offset + count
+		if end > int64(len(queue)) {
+			end = int64(len(queue))
+		}
+		return queue[offset:end], nil
+	}
+
+	var buf bytes.Buffer
+	n, err := exportTasks(context.Background(), &buf, peek)
+	is.NoErr(err)
+	is.Equal(n, len(queue))
+
+	var pushed []*task.Task
+	n, err = importTasks(context.Background(), &buf, func(ctx context.Context, t *task.Task) error {
+		pushed = append(pushed, t)
+		return nil
+	})
+	is.NoErr(err)
+	is.Equal(n, len(queue))
+	is.Equal(pushed[pageSize+2].Id, queue[pageSize+2].Id)
+	is.Equal(pushed[pageSize+2].Args, queue[pageSize+2].Args)
+
+	_, err = importTasks(context.Background(), strings.NewReader(`{"Id": "x"}`), nil)
+	is.Err(err)
+}
@@ -0,0 +1,242 @@
+// Command asq inspects and operates the redis queues of asq, without writing
+// Go.
+//
+//	asq [flags] command [command flags] [args]
+//
+// Commands:
+//
+//	enqueue name [json-args]   push a task, e.g. asq enqueue add '[1, 2]'
+//	wait id                    wait for the final state of a task
+//	inspect                    print the counts and the next waiting tasks
+//	purge                      delete the waiting, delayed or dead tasks
+//	delayed                    list the delayed tasks, from the earliest due
+//	reschedule id              move a delayed task to another time
+//	tail                       print the task states recorded by the workers
+//	workers                    list the registered workers, alive or dead
+//	control command [args]     broadcast ping, stats, pause, resume,
+//	                           concurrency n, rate_limit task rate or shutdown
+//	export                     write the tasks of a queue as JSON lines
+//	import [file]              push the tasks read from JSON lines
+//
+// The connection flags mirror redis.Option, the password and signing key are
+// read from ASQ_REDIS_PASSWORD and ASQ_SIGNING_KEY. The marshaller wraps the
+// payloads like the workers: -envelope, then -compress, then the encryption
+// keys of ASQ_ENCRYPTION_KEY, e.g. "2024-06:<base64>,2024-01:<base64>" where
+// the first key encrypts. Commands fail if no task decodes. wait and tail need the
+// workers to record the task states, see redis.Option.StateTTL. Tasks are
+// exported and imported as JSON, arguments of the gob, msgpack and proto
+// marshallers lose their Go types on the way.
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/redis"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, c *client, args []string) error
+}
+
+var commands []*command
+
+// commands 在 init 中赋值，避免与 newFlagSet 的初始化循环
+func init() {
+	commands = []*command{
+		{"enqueue", "enqueue [flags] name [json-args]", runEnqueue},
+		{"wait", "wait [flags] id", runWait},
+		{"inspect", "inspect [flags]", runInspect},
+		{"purge", "purge [flags]", runPurge},
+		{"delayed", "delayed [flags]", runDelayed},
+		{"reschedule", "reschedule [flags] id", runReschedule},
+		{"tail", "tail [flags]", runTail},
+		{"workers", "workers", runWorkers},
+		{"control", "control [flags] command [args]", runControl},
+		{"export", "export [flags]", runExport},
+		{"import", "import [flags] [file]", runImport},
+	}
+}
+
+func main() {
+	var (
+		addrs     = flag.String("addrs", "127.0.0.1:6379", "comma separated redis addresses")
+		db        = flag.Int("db", 0, "redis database")
+		username  = flag.String("username", "", "redis username")
+		master    = flag.String("master", "", "sentinel master name")
+		queue     = flag.String("queue", "default", "queue name")
+		codec     = flag.String("marshaller", "json", "marshaller of the workers: json, json-safe, gob, msgpack or proto")
+		envelope  = flag.Bool("envelope", false, "payloads are wrapped by the envelope marshaller")
+		blobDir   = flag.String("blob-dir", "", "directory of the file blob store, if the workers use one")
+		blobRedis = flag.Bool("blob-redis", false, "the workers offload large payloads to redis")
+		compress  = flag.String("compress", "", "payloads are compressed by the compress marshaller: gzip or zstd")
+	)
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := lookup(flag.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "asq: unknown command %s\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	m, err := newMarshaller(*codec, *envelope)
+	if err != nil {
+		fatal(err)
+	}
+	if m, err = wrapMarshaller(m, *compress, os.Getenv("ASQ_ENCRYPTION_KEY")); err != nil {
+		fatal(err)
+	}
+	opt := redis.DefaultOption()
+	opt.Addrs = strings.Split(*addrs, ",")
+	opt.DB = *db
+	opt.Username = *username
+	opt.Password = os.Getenv("ASQ_REDIS_PASSWORD")
+	opt.MasterName = *master
+	opt.Marshaller = m
+	if key := os.Getenv("ASQ_SIGNING_KEY"); key != "" {
+		opt.SigningKey = []byte(key)
+	}
+	if err := setBlobStore(opt, *blobDir, *blobRedis); err != nil {
+		fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	c, err := dial(opt, *queue)
+	if err != nil {
+		fatal(err)
+	}
+	defer c.Close()
+
+	if err := cmd.run(ctx, c, flag.Args()[1:]); err != nil {
+		c.Close()
+		fatal(err)
+	}
+}
+
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: asq [flags] command [command flags] [args]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "asq: %v\n", err)
+	os.Exit(1)
+}
+
+func newMarshaller(name string, envelope bool) (marshaller.Marshaller, error) {
+	var m marshaller.Marshaller
+	switch name {
+	case "json":
+		m = marshaller.NewJsonMarshaller()
+	case "json-safe":
+		m = marshaller.NewJsonSafeMarshaller()
+	case "gob":
+		m = marshaller.NewGobMarshaller()
+	case "msgpack":
+		m = marshaller.NewMsgpackMarshaller()
+	case "proto":
+		m = marshaller.NewProtoMarshaller()
+	default:
+		return nil, fmt.Errorf("unknown marshaller %s", name)
+	}
+	if !envelope {
+		return m, nil
+	}
+	// 信封中记录了 content type，其他格式的任务也能解码
+	return marshaller.NewEnvelopeMarshaller(m,
+		marshaller.NewJsonMarshaller(),
+		marshaller.NewJsonSafeMarshaller(),
+		marshaller.NewGobMarshaller(),
+		marshaller.NewMsgpackMarshaller(),
+		marshaller.NewProtoMarshaller())
+}
+
+// 与 README 中建议的阈值一致，只影响 enqueue 和 import 推送的任务，任何大小的
+// 压缩数据都能解码
+const compressThreshold = 4096
+
+// wrapMarshaller compresses with algorithm and encrypts with keys, a comma
+// separated list of id:base64 keys, if they are not empty.
+func wrapMarshaller(m marshaller.Marshaller, algorithm, keys string) (marshaller.Marshaller, error) {
+	if algorithm != "" {
+		cm, err := marshaller.NewCompressMarshaller(m, algorithm, compressThreshold)
+		if err != nil {
+			return nil, err
+		}
+		m = cm
+	}
+	if keys == "" {
+		return m, nil
+	}
+
+	var keyID string
+	keyMap := make(map[string][]byte)
+	for _, s := range strings.Split(keys, ",") {
+		i := strings.IndexByte(s, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid encryption key %q, id:base64 expected", s)
+		}
+		key, err := base64.StdEncoding.DecodeString(s[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", s[:i], err)
+		}
+		if keyID == "" {
+			keyID = s[:i]
+		}
+		keyMap[s[:i]] = key
+	}
+	return marshaller.NewEncryptMarshaller(m, keyID, keyMap)
+}
+
+// newFlagSet parses the flags of a command, -h prints its usage.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: asq %s\n", lookup(name).usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseTime accepts RFC 3339 times and durations from now.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, RFC 3339 or a duration like 10m", s)
+	}
+	return t, nil
+}
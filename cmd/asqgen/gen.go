@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// handler 是一个需要生成调用桩的函数签名，names 记录使用该签名的函数
+type handler struct {
+	sig   *types.Signature
+	names []string
+}
+
+type generator struct {
+	pkg     *types.Package
+	info    *types.Info
+	files   []*ast.File
+	imports map[string]string // path -> name
+	used    map[string]string // name -> path
+}
+
+// load parses and type checks the go package in dir, skipping test files and
+// the previously generated output.
+func load(dir, output string) (*generator, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, got %d", dir, len(pkgs))
+	}
+
+	var (
+		name  string
+		files []*ast.File
+	)
+	for k, p := range pkgs {
+		name = k
+		for _, f := range p.Files {
+			files = append(files, f)
+		}
+	}
+
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+		Uses:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		// the package may not build before the stubs are generated
+		Error: func(error) {},
+	}
+	abs, _ := filepath.Abs(dir)
+	pkg, _ := conf.Check(name, fset, files, info)
+	if pkg == nil {
+		return nil, fmt.Errorf("type check package %s in %s failed", name, abs)
+	}
+
+	return &generator{
+		pkg:     pkg,
+		info:    info,
+		files:   files,
+		imports: make(map[string]string),
+		used:    make(map[string]string),
+	}, nil
+}
+
+// lookup finds handlers by their function names.
+func (g *generator) lookup(names []string) ([]*handler, error) {
+	var found []*handler
+	for _, name := range names {
+		obj := g.pkg.Scope().Lookup(name)
+		if obj == nil {
+			return nil, fmt.Errorf("function %s not found in package %s", name, g.pkg.Name())
+		}
+		sig, ok := obj.Type().Underlying().(*types.Signature)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a function", name)
+		}
+		found = append(found, &handler{sig: sig, names: []string{name}})
+	}
+	return found, nil
+}
+
+// scan finds handlers passed to Register(name, fn) calls in the package.
+func (g *generator) scan() []*handler {
+	var found []*handler
+	for _, f := range g.files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || sel.Sel.Name != "Register" {
+				return true
+			}
+			tv, ok := g.info.Types[call.Args[1]]
+			if !ok || tv.Type == nil {
+				return true
+			}
+			if sig, ok := tv.Type.Underlying().(*types.Signature); ok {
+				found = append(found, &handler{sig: sig, names: []string{types.ExprString(call.Args[1])}})
+			}
+			return true
+		})
+	}
+	return found
+}
+
+// group merges handlers with identical signatures, since one stub serves all
+// functions of the same type.
+func (g *generator) group(handlers []*handler) ([]*handler, error) {
+	var grouped []*handler
+	for _, h := range handlers {
+		if h.sig.Variadic() {
+			return nil, fmt.Errorf("variadic function %s is not supported", h.names[0])
+		}
+		h.sig = types.NewSignature(nil, unnamed(h.sig.Params()), unnamed(h.sig.Results()), false)
+
+		merged := false
+		for _, x := range grouped {
+			if types.Identical(x.sig, h.sig) {
+				x.names = append(x.names, h.names...)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			grouped = append(grouped, h)
+		}
+	}
+	return grouped, nil
+}
+
+// unnamed drops parameter names so that the signature prints as a plain type.
+func unnamed(t *types.Tuple) *types.Tuple {
+	vars := make([]*types.Var, t.Len())
+	for i := 0; i < t.Len(); i++ {
+		vars[i] = types.NewParam(token.NoPos, nil, "", t.At(i).Type())
+	}
+	return types.NewTuple(vars...)
+}
+
+func (g *generator) qualifier(p *types.Package) string {
+	if p == g.pkg {
+		return ""
+	}
+	if name, ok := g.imports[p.Path()]; ok {
+		return name
+	}
+
+	name := p.Name()
+	for i := 2; ; i++ {
+		if _, ok := g.used[name]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s%d", p.Name(), i)
+	}
+	g.imports[p.Path()] = name
+	g.used[name] = p.Path()
+	return name
+}
+
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, g.qualifier)
+}
+
+// converters of basic types, anything else goes through invoker.Decode
+var converters = map[types.BasicKind]string{
+	types.Bool:    "ToBool",
+	types.Int:     "ToInt",
+	types.Int8:    "ToInt8",
+	types.Int16:   "ToInt16",
+	types.Int32:   "ToInt32",
+	types.Int64:   "ToInt64",
+	types.Uint:    "ToUint",
+	types.Uint8:   "ToUint8",
+	types.Uint16:  "ToUint16",
+	types.Uint32:  "ToUint32",
+	types.Uint64:  "ToUint64",
+	types.Float32: "ToFloat32",
+	types.Float64: "ToFloat64",
+	types.String:  "ToString",
+}
+
+var errorType = types.Universe.Lookup("error").Type()
+
+// decode writes the statements that convert src into a new variable dst.
+func (g *generator) decode(buf *bytes.Buffer, dst, src string, t types.Type) {
+	if b, ok := t.(*types.Basic); ok {
+		if conv, ok := converters[b.Kind()]; ok {
+			fmt.Fprintf(buf, "\t%s, err := invoker.%s(%s)\n", dst, conv, src)
+			fmt.Fprintf(buf, "\tif err != nil {\n\t\treturn nil, err\n\t}\n")
+			return
+		}
+	}
+
+	ts := g.typeString(t)
+	fmt.Fprintf(buf, "\tvar %s %s\n", dst, ts)
+	fmt.Fprintf(buf, "\tif v, ok := %s.(%s); ok {\n\t\t%s = v\n", src, ts, dst)
+	fmt.Fprintf(buf, "\t} else if err := invoker.Decode(%s, &%s); err != nil {\n\t\treturn nil, err\n\t}\n", src, dst)
+}
+
+func (g *generator) generate(handlers []*handler) ([]byte, error) {
+	g.qualifier(types.NewPackage("github.com/zigzed/asq/invoker", "invoker"))
+	g.qualifier(types.NewPackage("fmt", "fmt"))
+
+	var body bytes.Buffer
+	body.WriteString("func init() {\n")
+	for i, h := range handlers {
+		fmt.Fprintf(&body, "\tinvoker.RegisterTyped((%s)(nil), asqInvoker%d{})\n", g.typeString(h.sig), i)
+	}
+	body.WriteString("}\n")
+
+	for i, h := range handlers {
+		g.stub(&body, fmt.Sprintf("asqInvoker%d", i), h)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by asqgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", g.pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	buf.WriteString("import (\n")
+	for _, path := range paths {
+		if name := g.imports[path]; name != filepath.Base(path) {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, path)
+		} else {
+			fmt.Fprintf(&buf, "\t%q\n", path)
+		}
+	}
+	buf.WriteString(")\n\n")
+	buf.Write(body.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return buf.Bytes(), fmt.Errorf("format generated source failed: %v", err)
+	}
+	return src, nil
+}
+
+func (g *generator) stub(buf *bytes.Buffer, name string, h *handler) {
+	sig := g.typeString(h.sig)
+	params, results := h.sig.Params(), h.sig.Results()
+
+	fmt.Fprintf(buf, "\n// %s calls %s\n", name, strings.Join(h.names, ", "))
+	fmt.Fprintf(buf, "type %s struct{}\n\n", name)
+
+	fmt.Fprintf(buf, "func (%s) Invoke(f interface{}, param []interface{}) ([]interface{}, error) {\n", name)
+	fmt.Fprintf(buf, "\tfn, ok := f.(%s)\n", sig)
+	fmt.Fprintf(buf, "\tif !ok {\n\t\treturn nil, fmt.Errorf(\"unexpected function type %%T\", f)\n\t}\n")
+	fmt.Fprintf(buf, "\tif len(param) != %d {\n", params.Len())
+	fmt.Fprintf(buf, "\t\treturn nil, fmt.Errorf(\"parameter Count mismatch: %%v %%v\", len(param), %d)\n\t}\n", params.Len())
+	args := make([]string, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		args[i] = fmt.Sprintf("a%d", i)
+		g.decode(buf, args[i], fmt.Sprintf("param[%d]", i), params.At(i).Type())
+	}
+	rets := make([]string, results.Len())
+	for i := 0; i < results.Len(); i++ {
+		rets[i] = fmt.Sprintf("r%d", i)
+	}
+	if len(rets) == 0 {
+		fmt.Fprintf(buf, "\tfn(%s)\n", strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(buf, "\t%s := fn(%s)\n", strings.Join(rets, ", "), strings.Join(args, ", "))
+	}
+	fmt.Fprintf(buf, "\treturn []interface{}{%s}, nil\n}\n\n", strings.Join(rets, ", "))
+
+	fmt.Fprintf(buf, "func (%s) Return(f interface{}, returns []interface{}) ([]interface{}, error) {\n", name)
+	fmt.Fprintf(buf, "\tif len(returns) != %d {\n", results.Len())
+	fmt.Fprintf(buf, "\t\treturn nil, fmt.Errorf(\"parameter count mismatch: %%v %%v\", len(returns), %d)\n\t}\n", results.Len())
+	for i := 0; i < results.Len(); i++ {
+		if types.Identical(results.At(i).Type(), errorType) {
+			fmt.Fprintf(buf, "\t%s := returns[%d]\n", rets[i], i)
+			continue
+		}
+		g.decode(buf, rets[i], fmt.Sprintf("returns[%d]", i), results.At(i).Type())
+	}
+	fmt.Fprintf(buf, "\treturn []interface{}{%s}, nil\n}\n", strings.Join(rets, ", "))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+func TestGenerate(t *testing.T) {
+	is := is.New(t)
+
+	dir := filepath.Join("testdata", "demo")
+	g, err := load(dir, "asq_invoker_gen.go")
+	is.NoErr(err)
+
+	handlers, err := g.group(g.scan())
+	is.NoErr(err)
+	// add 和 mul 签名相同，共用一个调用桩
+	is.Equal(len(handlers), 3)
+	is.Equal(handlers[0].names, []string{"add", "mul"})
+
+	src, err := g.generate(handlers)
+	is.NoErr(err)
+	is.True(strings.Contains(string(src), "invoker.RegisterTyped((func(int, int) (int, error))(nil), asqInvoker0{})"))
+
+	// 生成的代码需要能够和原始代码一起通过类型检查
+	fset := token.NewFileSet()
+	gen, err := parser.ParseFile(fset, "asq_invoker_gen.go", src, 0)
+	is.NoErr(err)
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	is.NoErr(err)
+	files := []*ast.File{gen}
+	for _, f := range pkgs["demo"].Files {
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = conf.Check("demo", fset, files, nil)
+	is.NoErr(err)
+}
+
+func TestLookup(t *testing.T) {
+	is := is.New(t)
+
+	g, err := load(filepath.Join("testdata", "demo"), "asq_invoker_gen.go")
+	is.NoErr(err)
+
+	handlers, err := g.lookup([]string{"move"})
+	is.NoErr(err)
+	is.Equal(len(handlers), 1)
+
+	_, err = g.lookup([]string{"missing"})
+	is.Err(err)
+	_, err = g.lookup([]string{"Point"})
+	is.Err(err)
+}
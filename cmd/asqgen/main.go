@@ -0,0 +1,68 @@
+// Command asqgen generates reflection-free invokers for asq task handlers.
+//
+// Put a go:generate directive in the package that registers the handlers:
+//
+//	//go:generate go run github.com/zigzed/asq/cmd/asqgen
+//
+// Without arguments asqgen collects the functions passed to Register(name, fn)
+// calls in the package. Function names can also be listed explicitly:
+//
+//	//go:generate go run github.com/zigzed/asq/cmd/asqgen -output invokers.go handleA handleB
+//
+// The generated stubs are registered by function signature with
+// invoker.RegisterTyped and used by the worker in place of the reflection
+// based invoker. Functions without a stub still go through reflection.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	var (
+		output = flag.String("output", "asq_invoker_gen.go", "output file name")
+		dir    = flag.String("dir", ".", "directory of the package to scan")
+	)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: asqgen [flags] [function ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*dir, *output, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "asqgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, output string, names []string) error {
+	g, err := load(dir, output)
+	if err != nil {
+		return err
+	}
+
+	var handlers []*handler
+	if len(names) > 0 {
+		if handlers, err = g.lookup(names); err != nil {
+			return err
+		}
+	} else {
+		handlers = g.scan()
+	}
+	if len(handlers) == 0 {
+		return fmt.Errorf("no handler found in %s", dir)
+	}
+
+	if handlers, err = g.group(handlers); err != nil {
+		return err
+	}
+
+	src, err := g.generate(handlers)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, output), src, 0644)
+}
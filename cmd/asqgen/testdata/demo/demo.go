@@ -0,0 +1,36 @@
+package demo
+
+import (
+	"time"
+)
+
+type registry interface {
+	Register(name string, fn interface{}) error
+}
+
+type Point struct {
+	X, Y int
+}
+
+func add(a, b int) (int, error) {
+	return a + b, nil
+}
+
+func mul(a, b int) (int, error) {
+	return a * b, nil
+}
+
+func move(p *Point, d time.Duration, name string) (Point, error) {
+	return Point{X: p.X + 1, Y: p.Y + int(d)}, nil
+}
+
+func ping() error {
+	return nil
+}
+
+func setup(app registry) {
+	app.Register("add", add)
+	app.Register("mul", mul)
+	app.Register("move", move)
+	app.Register("ping", ping)
+}
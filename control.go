@@ -0,0 +1,196 @@
+package asq
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/control"
+	"github.com/zigzed/asq/task"
+)
+
+const (
+	// 暂停时检查恢复的间隔
+	pausedPoll = time.Second
+	// 并发数最多调整为 Start 时的 8 倍
+	maxGrowth = 8
+)
+
+var (
+	// ErrNoControl is returned by App.Broadcast if the app has no control.
+	ErrNoControl = errors.New("no control transport")
+	// ErrNotStarted is replied to the concurrency command before Start.
+	ErrNotStarted = errors.New("worker not started")
+)
+
+// WithControl lets the workers of the app receive the commands of t, and
+// App.Broadcast send them. NewAppFromRedis uses the redis control if
+// redis.Option.Control is set.
+func WithControl(t control.Transport) Options {
+	return func(app *App) {
+		app.control = t
+	}
+}
+
+// Broadcast sends cmd to the running workers of the queue and returns the
+// replies received before timeout.
+//
+//	replies, err := app.Broadcast(ctx, control.NewStats(), time.Second)
+func (app *App) Broadcast(ctx context.Context, cmd *control.Command, timeout time.Duration) ([]*control.Reply, error) {
+	if app.control == nil {
+		return nil, ErrNoControl
+	}
+	replies, err := app.control.Send(ctx, cmd, timeout)
+	if err != nil {
+		return nil, errors.Wrapf(err, "broadcast %s failed", cmd.Name)
+	}
+	return replies, nil
+}
+
+// executors is the pool of goroutines executing the polled tasks, it grows
+// and shrinks with the concurrency command.
+type executors struct {
+	ctx    context.Context
+	tasks  <-chan *task.Task
+	max    int
+	wg     sync.WaitGroup
+	quits  []chan struct{}
+	closed bool
+}
+
+// resize changes the number of executors, up to 8 times the size given to
+// Start. The removed ones finish their current task before quitting.
+func (w *Worker) resize(n int) error {
+	if n < 1 {
+		return errors.Errorf("invalid concurrency %d", n)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pool := w.pool
+	if pool == nil || pool.closed {
+		return ErrNotStarted
+	}
+	if n > pool.max {
+		return errors.Errorf("concurrency %d exceeds the maximum %d", n, pool.max)
+	}
+	for len(pool.quits) < n {
+		quit := make(chan struct{})
+		pool.quits = append(pool.quits, quit)
+		pool.wg.Add(1)
+		go func() {
+			defer pool.wg.Done()
+			w.doExecute(pool.ctx, pool.tasks, quit)
+		}()
+	}
+	for len(pool.quits) > n {
+		last := len(pool.quits) - 1
+		close(pool.quits[last])
+		pool.quits = pool.quits[:last]
+	}
+	w.concurrency = n
+	return nil
+}
+
+func (w *Worker) listen(ctx context.Context) {
+	if err := w.control.Listen(ctx, w.command); err != nil {
+		w.logger.Error("asq: listen control commands failed", "worker", w.id, "error", err)
+	}
+}
+
+// command handles cmd if it is sent to all the workers or to this one.
+func (w *Worker) command(cmd *control.Command) *control.Reply {
+	if len(cmd.Workers) > 0 && !contains(cmd.Workers, w.id) {
+		return nil
+	}
+
+	reply := &control.Reply{Command: cmd.Name, Worker: w.id}
+	var err error
+	switch cmd.Name {
+	case control.Ping:
+	case control.Stats:
+		reply.Stats = w.stats()
+	case control.Pause:
+		atomic.StoreInt32(&w.paused, 1)
+	case control.Resume:
+		atomic.StoreInt32(&w.paused, 0)
+	case control.Concurrency:
+		err = w.resize(cmd.Concurrency)
+	case control.RateLimit:
+		err = w.setRateLimit(cmd.Task, cmd.Rate)
+	case control.Shutdown:
+		w.shutdown()
+	default:
+		err = errors.Errorf("unknown command %s", cmd.Name)
+	}
+
+	if err != nil {
+		reply.Error = err.Error()
+		w.logger.Warn("asq: control command failed", "command", cmd.Name, "worker", w.id, "error", err)
+	} else if cmd.Name != control.Ping && cmd.Name != control.Stats {
+		w.logger.Info("asq: control command applied", "command", cmd.Name, "worker", w.id)
+	}
+	return reply
+}
+
+func (w *Worker) isPaused() bool {
+	return atomic.LoadInt32(&w.paused) == 1
+}
+
+func (w *Worker) stats() *control.WorkerStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	st := &control.WorkerStats{
+		Concurrency: w.concurrency,
+		Paused:      w.isPaused(),
+		Running:     len(w.running),
+		Succeeded:   atomic.LoadInt64(&w.succeeded),
+		Failed:      atomic.LoadInt64(&w.failed),
+		Started:     w.started,
+	}
+	for name, l := range w.limits {
+		if rate := l.limit(); rate > 0 {
+			if st.RateLimits == nil {
+				st.RateLimits = make(map[string]float64)
+			}
+			st.RateLimits[name] = rate
+		}
+	}
+	return st
+}
+
+func (w *Worker) setRateLimit(name string, rate float64) error {
+	if rate < 0 {
+		return errors.Errorf("invalid rate limit %v of %s", rate, name)
+	}
+	h, err := w.fnMgr.lookup(name)
+	if err != nil {
+		return err
+	}
+	w.limiter(name, h).setRate(rate)
+	return nil
+}
+
+// shutdown stops the polling, Start returns after the polled tasks are
+// executed.
+func (w *Worker) shutdown() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stop != nil {
+		w.stop()
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Package control broadcasts commands to the running workers of a queue and
+// collects their replies, like the inspect and control commands of Celery.
+//
+//	replies, err := app.Broadcast(ctx, control.SetRateLimit("send", 10), time.Second)
+package control
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	Ping        = "ping"
+	Stats       = "stats"
+	Pause       = "pause"
+	Resume      = "resume"
+	Concurrency = "concurrency"
+	RateLimit   = "rate_limit"
+	Shutdown    = "shutdown"
+)
+
+// Command is sent to all the workers of a queue, or to Workers only.
+type Command struct {
+	Id      string   `json:"id"`
+	Name    string   `json:"name"`
+	Workers []string `json:"workers,omitempty"`
+	// IssuedAt is the unix milliseconds the command is sent at, signed with
+	// the command so that the workers drop the replayed ones
+	IssuedAt int64 `json:"issued_at,omitempty"`
+
+	// Concurrency is the number of executors for the concurrency command
+	Concurrency int `json:"concurrency,omitempty"`
+	// Task and Rate, in tasks per second, are for the rate_limit command,
+	// a zero rate removes the limit
+	Task string  `json:"task,omitempty"`
+	Rate float64 `json:"rate,omitempty"`
+}
+
+// Reply is the answer of a worker, Error is set if the command failed.
+type Reply struct {
+	Command string       `json:"command"`
+	Worker  string       `json:"worker"`
+	Error   string       `json:"error,omitempty"`
+	Stats   *WorkerStats `json:"stats,omitempty"`
+}
+
+// WorkerStats is the reply of the stats command.
+type WorkerStats struct {
+	Concurrency int                `json:"concurrency"`
+	Paused      bool               `json:"paused"`
+	Running     int                `json:"running"`
+	Succeeded   int64              `json:"succeeded"`
+	Failed      int64              `json:"failed"`
+	RateLimits  map[string]float64 `json:"rate_limits,omitempty"`
+	Started     time.Time          `json:"started"`
+}
+
+// Transport carries the commands and replies, like the redis control.
+type Transport interface {
+	// Listen calls handle with the received commands until ctx is done, the
+	// non-nil replies are sent back to the sender.
+	Listen(ctx context.Context, handle func(cmd *Command) *Reply) error
+	// Send broadcasts cmd and collects the replies until timeout, or until
+	// all the workers of cmd.Workers replied.
+	Send(ctx context.Context, cmd *Command, timeout time.Duration) ([]*Reply, error)
+}
+
+func NewPing(workers ...string) *Command {
+	return &Command{Name: Ping, Workers: workers}
+}
+
+func NewStats(workers ...string) *Command {
+	return &Command{Name: Stats, Workers: workers}
+}
+
+// NewPause stops the polling of the workers, the queue is still consumed by
+// other workers. The running tasks are not interrupted.
+func NewPause(workers ...string) *Command {
+	return &Command{Name: Pause, Workers: workers}
+}
+
+func NewResume(workers ...string) *Command {
+	return &Command{Name: Resume, Workers: workers}
+}
+
+// SetConcurrency changes the number of tasks executed at the same time.
+func SetConcurrency(n int, workers ...string) *Command {
+	return &Command{Name: Concurrency, Concurrency: n, Workers: workers}
+}
+
+// SetRateLimit limits the executions of task per second on each worker, a
+// zero rate removes the limit.
+func SetRateLimit(task string, rate float64, workers ...string) *Command {
+	return &Command{Name: RateLimit, Task: task, Rate: rate, Workers: workers}
+}
+
+// NewShutdown stops the workers gracefully, they stop polling and return
+// from Start after finishing the polled tasks.
+func NewShutdown(workers ...string) *Command {
+	return &Command{Name: Shutdown, Workers: workers}
+}
@@ -0,0 +1,226 @@
+package asq
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/control"
+	"github.com/zigzed/asq/task"
+)
+
+// memControl 在进程内广播命令
+type memControl struct {
+	sync.Mutex
+	handlers map[int]func(*control.Command) *control.Reply
+	next     int
+}
+
+func (mc *memControl) Listen(ctx context.Context, handle func(*control.Command) *control.Reply) error {
+	mc.Lock()
+	id := mc.next
+	mc.next++
+	mc.handlers[id] = handle
+	mc.Unlock()
+
+	<-ctx.Done()
+	mc.Lock()
+	delete(mc.handlers, id)
+	mc.Unlock()
+	return nil
+}
+
+func (mc *memControl) Send(ctx context.Context, cmd *control.Command, timeout time.Duration) ([]*control.Reply, error) {
+	mc.Lock()
+	defer mc.Unlock()
+
+	var replies []*control.Reply
+	for _, handle := range mc.handlers {
+		if reply := handle(cmd); reply != nil {
+			replies = append(replies, reply)
+		}
+	}
+	return replies, nil
+}
+
+func (mc *memControl) len() int {
+	mc.Lock()
+	defer mc.Unlock()
+
+	return len(mc.handlers)
+}
+
+// chanBroker 的 Poll 阻塞等待推送的任务，延迟的任务到期后才能拉取
+type chanBroker struct {
+	memBroker
+	ch chan *task.Task
+}
+
+func (cb *chanBroker) Push(ctx context.Context, t *task.Task) error {
+	if t.Option.StartAt != nil {
+		if delay := time.Until(time.UnixMilli(*t.Option.StartAt)); delay > 0 {
+			time.AfterFunc(delay, func() { cb.ch <- t })
+			return nil
+		}
+	}
+	cb.ch <- t
+	return nil
+}
+
+func (cb *chanBroker) Poll(ctx context.Context, timeout time.Duration) (*task.Task, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case t := <-cb.ch:
+		return t, nil
+	}
+}
+
+func TestControl(t *testing.T) {
+	is := is.New(t)
+
+	ctl := &memControl{handlers: make(map[int]func(*control.Command) *control.Reply)}
+	broker := &chanBroker{ch: make(chan *task.Task, 10)}
+	app := NewApp(broker, &memBackend{}, WithControl(ctl))
+	done := make(chan string, 10)
+	is.NoErr(app.Register("work", func(id string) error {
+		done <- id
+		return nil
+	}))
+	w := app.newWorker()
+	ctx := context.Background()
+
+	// 启动前暂停，不拉取任务
+	w.command(control.NewPause())
+	stopped := make(chan struct{})
+	go func() {
+		w.Start(ctx, 2)
+		close(stopped)
+	}()
+	for i := 0; i < 100 && ctl.len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	replies, err := app.Broadcast(ctx, control.NewPing(), time.Second)
+	is.NoErr(err)
+	is.Equal(len(replies), 1)
+	is.Equal(replies[0].Worker, w.ID())
+	replies, err = app.Broadcast(ctx, control.NewPing("other"), time.Second)
+	is.NoErr(err)
+	is.Equal(len(replies), 0)
+
+	_, err = app.SubmitTask(ctx, task.NewTask(nil, "work", "t1"))
+	is.NoErr(err)
+	select {
+	case <-done:
+		t.Fatal("task executed while paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	_, err = app.Broadcast(ctx, control.NewResume(), time.Second)
+	is.NoErr(err)
+	select {
+	case id := <-done:
+		is.Equal(id, "t1")
+	case <-time.After(3 * time.Second):
+		t.Fatal("task not executed after resume")
+	}
+
+	replies, err = app.Broadcast(ctx, control.SetConcurrency(4), time.Second)
+	is.NoErr(err)
+	is.Equal(replies[0].Error, "")
+	replies, err = app.Broadcast(ctx, control.SetConcurrency(0), time.Second)
+	is.NoErr(err)
+	is.NotEqual(replies[0].Error, "")
+	replies, err = app.Broadcast(ctx, control.SetConcurrency(17), time.Second)
+	is.NoErr(err)
+	is.NotEqual(replies[0].Error, "")
+
+	replies, err = app.Broadcast(ctx, control.SetRateLimit("work", 20), time.Second)
+	is.NoErr(err)
+	is.Equal(replies[0].Error, "")
+	replies, err = app.Broadcast(ctx, control.SetRateLimit("unknown", 20), time.Second)
+	is.NoErr(err)
+	is.NotEqual(replies[0].Error, "")
+
+	start := time.Now()
+	for _, id := range []string{"t2", "t3", "t4"} {
+		_, err = app.SubmitTask(ctx, task.NewTask(nil, "work", id))
+		is.NoErr(err)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	is.True(time.Since(start) >= 90*time.Millisecond)
+
+	// done 在函数返回前发送，等待计数更新
+	var st *control.WorkerStats
+	for i := 0; i < 100; i++ {
+		replies, err = app.Broadcast(ctx, control.NewStats(), time.Second)
+		is.NoErr(err)
+		if st = replies[0].Stats; st.Succeeded == 4 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	is.Equal(st.Concurrency, 4)
+	is.False(st.Paused)
+	is.Equal(st.Succeeded, int64(4))
+	is.Equal(st.Failed, int64(0))
+	is.Equal(st.RateLimits["work"], 20.0)
+
+	_, err = app.Broadcast(ctx, control.NewShutdown(), time.Second)
+	is.NoErr(err)
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("worker not stopped by shutdown")
+	}
+
+	_, err = NewApp(broker, &memBackend{}).Broadcast(ctx, control.NewPing(), time.Second)
+	is.Equal(err, ErrNoControl)
+}
+
+func TestThrottle(t *testing.T) {
+	is := is.New(t)
+
+	calls := 0
+	var kinds []EventKind
+	broker, backend := &memBroker{}, &memBackend{}
+	app := NewApp(broker, backend, WithListeners(func(e Event) { kinds = append(kinds, e.Kind) }))
+	is.NoErr(app.Register("send", func() error {
+		calls++
+		return nil
+	}, WithRateLimit(1)))
+	w := app.newWorker()
+	ctx := context.Background()
+
+	is.NoErr(w.execute(ctx, task.NewTask(nil, "send")))
+	is.Equal(calls, 1)
+
+	// 超过速率的任务重新调度到预留的时间，不阻塞
+	start := time.Now()
+	t2 := task.NewTask(nil, "send")
+	is.NoErr(w.execute(ctx, t2))
+	is.True(time.Since(start) < 100*time.Millisecond)
+	is.Equal(calls, 1)
+	is.Equal(len(broker.tasks), 1)
+	// 限流不是重试，不报告 retried
+	is.Equal(kinds, []EventKind{EventStarted, EventSucceeded})
+	at := t2.Headers[rateHeader]
+	is.NotEqual(at, "")
+
+	// 提前拉取时继续等待，不再预留新的时间
+	is.NoErr(w.execute(ctx, t2))
+	is.Equal(calls, 1)
+	is.Equal(len(broker.tasks), 2)
+	is.Equal(t2.Headers[rateHeader], at)
+
+	t2.SetHeader(rateHeader, strconv.FormatInt(time.Now().UnixMilli(), 10))
+	is.NoErr(w.execute(ctx, t2))
+	is.Equal(calls, 2)
+	_, ok := t2.Headers[rateHeader]
+	is.False(ok)
+}
@@ -0,0 +1,88 @@
+package asq
+
+import (
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/result"
+)
+
+// ErrRevoked is the error of a task revoked before it was executed.
+var ErrRevoked = errors.New("task revoked")
+
+func init() {
+	result.RegisterError(ErrRevoked)
+}
+
+// PermanentError is returned by a task function for errors that won't go away
+// on retry, e.g. invalid arguments. The task fails without further retries.
+type PermanentError struct {
+	Err error
+}
+
+// NewPermanentError marks err as permanent, it returns nil if err is nil.
+func NewPermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PermanentError) Retryable() bool {
+	return false
+}
+
+// RetryLaterError is returned by a task function to run the task again after
+// Delay. It doesn't count as a failed attempt.
+type RetryLaterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// NewRetryLaterError asks for the task to be retried after delay.
+func NewRetryLaterError(err error, delay time.Duration) error {
+	return &RetryLaterError{Err: err, Delay: delay}
+}
+
+func (e *RetryLaterError) Error() string {
+	if e.Err == nil {
+		return "retry later"
+	}
+	return e.Err.Error()
+}
+
+func (e *RetryLaterError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryLaterError) Retryable() bool {
+	return true
+}
+
+// isPermanent reports errors that must not be retried, including any error
+// in the chain with a Retryable method returning false.
+func isPermanent(err error) bool {
+	var r interface{ Retryable() bool }
+	return errors.As(err, &r) && !r.Retryable()
+}
+
+// errorKeys returns the codes and type names of the errors in the chain, they
+// select the overrides of the retry policy.
+func errorKeys(err error) []string {
+	var keys []string
+	for e := result.NewError(err); e != nil; e = e.Cause {
+		if e.Code != "" {
+			keys = append(keys, e.Code)
+		}
+		keys = append(keys, e.Type)
+	}
+	return keys
+}
@@ -0,0 +1,108 @@
+package asq
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zigzed/asq/task"
+)
+
+type EventKind int
+
+const (
+	// EventSubmitted is a task pushed to the broker by SubmitTask, or a
+	// following task pushed by the worker.
+	EventSubmitted EventKind = iota
+	EventStarted
+	EventSucceeded
+	// EventFailed is reported for every failed attempt, followed by
+	// EventRetried, EventDeadLettered or EventGivenUp.
+	EventFailed
+	EventRetried
+	EventDeadLettered
+	// EventRevoked is a revoked task dropped by the worker.
+	EventRevoked
+	// EventGivenUp is a task failed for the last time and not dead lettered,
+	// e.g. without a dead letter queue.
+	EventGivenUp
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventSubmitted:
+		return "submitted"
+	case EventStarted:
+		return "started"
+	case EventSucceeded:
+		return "succeeded"
+	case EventFailed:
+		return "failed"
+	case EventRetried:
+		return "retried"
+	case EventDeadLettered:
+		return "dead_lettered"
+	case EventRevoked:
+		return "revoked"
+	case EventGivenUp:
+		return "given_up"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// Event is a step in the life of a task, reported to the listeners.
+type Event struct {
+	Kind   EventKind
+	Task   *task.Task
+	Worker string // id of the worker, empty for tasks submitted by the app
+	// Wait is the time the task spent in the queue for EventStarted, zero
+	// if the producer did not record the submit time.
+	Wait time.Duration
+	// Duration is the execution time for EventSucceeded and EventFailed.
+	Duration time.Duration
+	// Results are the returns of the function for EventSucceeded.
+	Results []interface{}
+	Err     error
+}
+
+// Listener receives the events of tasks, it is called synchronously and must
+// not block.
+type Listener func(e Event)
+
+// WithListeners adds listeners of the task events, e.g. for metrics.
+func WithListeners(listeners ...Listener) Options {
+	return func(app *App) {
+		app.listeners = append(app.listeners, listeners...)
+	}
+}
+
+func emit(listeners []Listener, e Event) {
+	for _, l := range listeners {
+		l(e)
+	}
+}
+
+// queueWait is the time since the task was submitted, or became due for
+// delayed tasks.
+func queueWait(t *task.Task, now time.Time) time.Duration {
+	if t.SubmittedAt == 0 {
+		return 0
+	}
+	since := t.SubmittedAt
+	if t.Option.StartAt != nil && *t.Option.StartAt > since {
+		since = *t.Option.StartAt
+	}
+	if wait := now.Sub(time.UnixMilli(since)); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8])
+}
@@ -0,0 +1,126 @@
+package asq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+)
+
+func TestEvents(t *testing.T) {
+	is := is.New(t)
+
+	var events []Event
+	listener := WithListeners(func(e Event) {
+		events = append(events, e)
+	})
+	kinds := func() []EventKind {
+		ks := make([]EventKind, len(events))
+		for i, e := range events {
+			ks[i] = e.Kind
+		}
+		events = nil
+		return ks
+	}
+
+	broker, backend := &memBroker{}, &memBackend{}
+	app := NewApp(broker, backend, listener, WithDeadLetters())
+	is.NoErr(app.Register("flaky", func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n, nil
+	}))
+	w := app.newWorker()
+
+	_, err := app.SubmitTask(context.Background(),
+		task.NewTask(task.NewTaskOption(1, time.Second), "flaky", 1),
+		task.NewTask(task.NewTaskOption(1, time.Second), "flaky"))
+	is.NoErr(err)
+	is.Equal(kinds(), []EventKind{EventSubmitted})
+	is.True(broker.tasks[0].SubmittedAt > 0)
+
+	is.NoErr(w.execute(context.Background(), broker.tasks[0]))
+	is.Equal(kinds(), []EventKind{EventStarted, EventSucceeded, EventSubmitted})
+	is.NoErr(w.execute(context.Background(), broker.tasks[1]))
+	is.Equal(kinds(), []EventKind{EventStarted, EventSucceeded})
+
+	t1 := task.NewTask(task.NewTaskOption(1, time.Second), "flaky", -1)
+	is.NoErr(w.execute(context.Background(), t1))
+	evs := events
+	is.Equal(kinds(), []EventKind{EventStarted, EventFailed, EventRetried})
+	is.Equal(evs[0].Worker, w.ID())
+	is.Err(evs[1].Err)
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(kinds(), []EventKind{EventStarted, EventFailed, EventDeadLettered})
+	is.Equal(len(broker.dead), 1)
+}
+
+func TestGivenUp(t *testing.T) {
+	is := is.New(t)
+
+	var kinds []EventKind
+	listener := WithListeners(func(e Event) { kinds = append(kinds, e.Kind) })
+	w, broker, _ := newMemWorker(t, "fail", func() error {
+		return errors.New("failed")
+	}, listener)
+
+	// 没有死信队列时，最后一次失败以 given_up 结束
+	is.NoErr(w.execute(context.Background(), task.NewTask(task.NewTaskOption(0, time.Second), "fail")))
+	is.Equal(kinds, []EventKind{EventStarted, EventFailed, EventGivenUp})
+	is.Equal(len(broker.dead), 0)
+	is.Equal(stateStatus(EventGivenUp), task.StatusGivenUp)
+}
+
+func TestQueueWait(t *testing.T) {
+	is := is.New(t)
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	t1 := task.NewTask(nil, "a")
+	is.Equal(queueWait(t1, now), time.Duration(0))
+
+	t1.SubmittedAt = now.Add(-time.Minute).UnixMilli()
+	is.Equal(queueWait(t1, now), time.Minute)
+
+	// 延迟任务从到期开始计算
+	t1.Option.WithStartAt(now.Add(-time.Second))
+	is.Equal(queueWait(t1, now), time.Second)
+}
+
+type memStates map[string]*task.State
+
+func (ms memStates) SetState(ctx context.Context, st *task.State) error {
+	ms[st.Id] = st
+	return nil
+}
+
+func (ms memStates) State(ctx context.Context, id string) (*task.State, error) {
+	return ms[id], nil
+}
+
+func TestStateStore(t *testing.T) {
+	is := is.New(t)
+
+	states := memStates{}
+	w, _, _ := newMemWorker(t, "double", func(n int) (int, error) {
+		if n < 0 {
+			return 0, errors.New("negative")
+		}
+		return n * 2, nil
+	}, WithStateStore(states))
+
+	t1 := task.NewTask(task.NewTaskOption(1, time.Second), "double", 21)
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(states[t1.Id].Status, task.StatusSucceeded)
+	is.Equal(states[t1.Id].Results, "[42]")
+	is.Equal(states[t1.Id].Worker, w.ID())
+
+	t2 := task.NewTask(task.NewTaskOption(1, time.Second), "double", -1)
+	is.NoErr(w.execute(context.Background(), t2))
+	is.Equal(states[t2.Id].Status, task.StatusRetrying)
+	is.Equal(states[t2.Id].Error, "negative")
+	is.Equal(states[t2.Id].Attempts, 1)
+}
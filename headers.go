@@ -0,0 +1,59 @@
+package asq
+
+import (
+	"context"
+	"reflect"
+)
+
+type headersKey struct{}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// HeadersFromContext returns the headers of the task being executed, for
+// handlers taking a context.Context as the first parameter.
+func HeadersFromContext(ctx context.Context) map[string]string {
+	headers, _ := ctx.Value(headersKey{}).(map[string]string)
+	return headers
+}
+
+func contextWithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// takesContext reports whether fn expects the context as the first parameter,
+// which is not part of the task args.
+func takesContext(fn interface{}) bool {
+	t := reflect.TypeOf(fn)
+	return t.Kind() == reflect.Func && t.NumIn() > 0 && t.In(0) == contextType
+}
+
+// paramTypes returns the types of the task args of fn, i.e. its parameters
+// without the context.
+func paramTypes(fn interface{}) []reflect.Type {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil
+	}
+	var types []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && t.In(0) == contextType {
+			continue
+		}
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		types = append(types, in)
+	}
+	return types
+}
+
+// returnsError reports functions whose last result is an error, it is
+// returned as the error of the task instead of a result.
+func returnsError(fn interface{}) bool {
+	t := reflect.TypeOf(fn)
+	return t.Kind() == reflect.Func && t.NumOut() > 0 && t.Out(t.NumOut()-1).Implements(errorType)
+}
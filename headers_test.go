@@ -0,0 +1,62 @@
+package asq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+)
+
+func TestHeaders(t *testing.T) {
+	is := is.New(t)
+
+	var seen []map[string]string
+	w, broker, _ := newMemWorker(t, "step", func(ctx context.Context, n int) (int, error) {
+		seen = append(seen, HeadersFromContext(ctx))
+		return n + 1, nil
+	})
+
+	t1 := task.NewTask(nil, "step", 1).SetHeader("request-id", "r1")
+	t1.OnSuccess = []*task.Task{task.NewTask(nil, "step").SetHeader("locale", "en")}
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(seen[0], map[string]string{"request-id": "r1"})
+
+	// 后续任务继承 headers，自己设置的保持不变
+	is.Equal(len(broker.tasks), 1)
+	t2 := broker.tasks[0]
+	is.Equal(t2.Args, []interface{}{2})
+	is.Equal(t2.Headers, map[string]string{"request-id": "r1", "locale": "en"})
+	is.NoErr(w.execute(context.Background(), t2))
+	is.Equal(seen[1], map[string]string{"request-id": "r1", "locale": "en"})
+}
+
+func TestHeadersRetry(t *testing.T) {
+	is := is.New(t)
+
+	w, broker, _ := newMemWorker(t, "flaky", func(ctx context.Context) error {
+		return errors.Errorf("flaky %s", HeadersFromContext(ctx)["tenant"])
+	})
+
+	t1 := task.NewTask(task.NewTaskOption(1, time.Second), "flaky").SetHeader("tenant", "t1")
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(broker.tasks), 1)
+	is.Equal(broker.tasks[0].Headers["tenant"], "t1")
+}
+
+func TestSubmitHeaders(t *testing.T) {
+	is := is.New(t)
+
+	broker := &memBroker{}
+	app := NewApp(broker, &memBackend{})
+
+	_, err := app.SubmitTask(context.Background(),
+		task.NewTask(nil, "a").SetHeader("request-id", "r1"),
+		task.NewTask(nil, "b"),
+		task.NewTask(nil, "c"))
+	is.NoErr(err)
+	is.Equal(broker.tasks[0].OnSuccess[0].Headers["request-id"], "r1")
+	is.Equal(broker.tasks[0].OnSuccess[0].OnSuccess[0].Headers["request-id"], "r1")
+}
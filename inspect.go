@@ -0,0 +1,58 @@
+package asq
+
+import (
+	"context"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/task"
+)
+
+// ErrNotInspectable is returned by the inspection methods of App if the
+// broker does not implement Inspector.
+var ErrNotInspectable = errors.New("broker does not support inspection")
+
+// Len returns the number of tasks waiting in the queue of the app, e.g. for
+// autoscalers and health checks.
+func (app *App) Len(ctx context.Context) (int64, error) {
+	in, err := app.inspector()
+	if err != nil {
+		return 0, err
+	}
+	return in.Len(ctx)
+}
+
+// DelayedLen returns the number of tasks scheduled for later.
+func (app *App) DelayedLen(ctx context.Context) (int64, error) {
+	in, err := app.inspector()
+	if err != nil {
+		return 0, err
+	}
+	return in.DelayedLen(ctx)
+}
+
+// Peek returns up to count waiting tasks after skipping offset, without
+// consuming them.
+func (app *App) Peek(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	in, err := app.inspector()
+	if err != nil {
+		return nil, err
+	}
+	return in.Peek(ctx, offset, count)
+}
+
+// Purge deletes the waiting tasks and returns their number.
+func (app *App) Purge(ctx context.Context) (int64, error) {
+	in, err := app.inspector()
+	if err != nil {
+		return 0, err
+	}
+	return in.Purge(ctx)
+}
+
+func (app *App) inspector() (Inspector, error) {
+	in, ok := app.broker.(Inspector)
+	if !ok {
+		return nil, ErrNotInspectable
+	}
+	return in, nil
+}
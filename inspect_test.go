@@ -0,0 +1,41 @@
+package asq
+
+import (
+	"context"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+)
+
+func TestInspect(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	app := NewApp(&memBroker{}, &memBackend{})
+	for i := 0; i < 3; i++ {
+		_, err := app.SubmitTask(ctx, task.NewTask(nil, "add", i, 1))
+		is.NoErr(err)
+	}
+
+	n, err := app.Len(ctx)
+	is.NoErr(err)
+	is.Equal(n, int64(3))
+
+	tasks, err := app.Peek(ctx, 1, 5)
+	is.NoErr(err)
+	is.Equal(len(tasks), 2)
+	is.Equal(tasks[0].Args[0], 1)
+
+	n, err = app.Purge(ctx)
+	is.NoErr(err)
+	is.Equal(n, int64(3))
+	n, err = app.Len(ctx)
+	is.NoErr(err)
+	is.Equal(n, int64(0))
+
+	type pushOnly struct{ Broker }
+	_, err = NewApp(pushOnly{}, &memBackend{}).Len(ctx)
+	is.True(errors.Is(err, ErrNotInspectable))
+}
@@ -0,0 +1,58 @@
+package asq
+
+import (
+	"context"
+
+	"github.com/zigzed/asq/task"
+)
+
+// Handler executes a task on the worker and returns the results of the
+// function, without the trailing error which is returned as err.
+type Handler func(ctx context.Context, t *task.Task) ([]interface{}, error)
+
+// Interceptor wraps the execution of tasks, it calls next to run the task and
+// may inspect or change the task, the returns and the error.
+type Interceptor func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error)
+
+// SubmitHandler pushes a task to the broker.
+type SubmitHandler func(ctx context.Context, t *task.Task) error
+
+// SubmitInterceptor wraps SubmitTask, it may enrich or validate the task
+// before calling next, or reject it by returning an error.
+type SubmitInterceptor func(ctx context.Context, t *task.Task, next SubmitHandler) error
+
+// WithInterceptors adds interceptors around the execution of tasks, the first
+// one is the outermost.
+func WithInterceptors(interceptors ...Interceptor) Options {
+	return func(app *App) {
+		app.interceptors = append(app.interceptors, interceptors...)
+	}
+}
+
+// WithSubmitInterceptors adds interceptors around SubmitTask, the first one is
+// the outermost.
+func WithSubmitInterceptors(interceptors ...SubmitInterceptor) Options {
+	return func(app *App) {
+		app.submitInterceptors = append(app.submitInterceptors, interceptors...)
+	}
+}
+
+func chainInterceptors(interceptors []Interceptor, h Handler) Handler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, t *task.Task) ([]interface{}, error) {
+			return interceptor(ctx, t, next)
+		}
+	}
+	return h
+}
+
+func chainSubmitInterceptors(interceptors []SubmitInterceptor, h SubmitHandler) SubmitHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], h
+		h = func(ctx context.Context, t *task.Task) error {
+			return interceptor(ctx, t, next)
+		}
+	}
+	return h
+}
@@ -0,0 +1,117 @@
+package asq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+)
+
+func TestInterceptors(t *testing.T) {
+	is := is.New(t)
+
+	var trace []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error) {
+			trace = append(trace, name+">")
+			returns, err := next(ctx, t)
+			trace = append(trace, "<"+name)
+			return returns, err
+		}
+	}
+	double := func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error) {
+		returns, err := next(ctx, t)
+		is.NoErr(err)
+		is.Equal(returns, []interface{}{3})
+		return []interface{}{returns[0].(int) * 2}, nil
+	}
+
+	w, _, backend := newMemWorker(t, "add", func(a, b int) (int, error) {
+		trace = append(trace, "add")
+		return a + b, nil
+	}, WithInterceptors(record("a"), record("b"), double))
+
+	is.NoErr(w.execute(context.Background(), task.NewTask(nil, "add", 1, 2)))
+	is.Equal(trace, []string{"a>", "b>", "add", "<b", "<a"})
+	is.Equal(len(backend.results), 1)
+	is.Equal(backend.results[0].Results, []interface{}{6})
+
+	// 拦截器返回的错误按任务失败处理
+	errDenied := errors.New("denied")
+	w, _, backend = newMemWorker(t, "add", func(a, b int) (int, error) {
+		return a + b, nil
+	}, WithInterceptors(func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error) {
+		return nil, NewPermanentError(errDenied)
+	}))
+	is.NoErr(w.execute(context.Background(), task.NewTask(nil, "add", 1, 2)))
+	is.Equal(len(backend.results), 1)
+	is.True(errors.Is(backend.results[0].Error, errDenied))
+
+	// 函数返回的错误和 panic
+	errFailed := errors.New("failed")
+	var seen []error
+	observe := WithInterceptors(func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error) {
+		returns, err := next(ctx, t)
+		seen = append(seen, err)
+		return returns, err
+	})
+	w, _, _ = newMemWorker(t, "fail", func() error { return errFailed }, observe)
+	is.NoErr(w.execute(context.Background(), task.NewTask(task.NewTaskOption(0, time.Second), "fail")))
+	w, _, _ = newMemWorker(t, "panic", func() error { panic("boom") }, observe)
+	is.NoErr(w.execute(context.Background(), task.NewTask(task.NewTaskOption(0, time.Second), "panic")))
+	is.Equal(len(seen), 2)
+	is.Equal(seen[0], errFailed)
+	is.Err(seen[1])
+
+	// 拦截器的 panic 也按任务失败处理
+	w, _, backend = newMemWorker(t, "add", func(a, b int) (int, error) {
+		return a + b, nil
+	}, WithInterceptors(func(ctx context.Context, t *task.Task, next Handler) ([]interface{}, error) {
+		panic("boom")
+	}))
+	is.NoErr(w.execute(context.Background(), task.NewTask(task.NewTaskOption(0, time.Second), "add", 1, 2)))
+	is.Equal(len(backend.results), 1)
+	is.Err(backend.results[0].Error)
+	is.Equal(len(w.info().Running), 0)
+}
+
+func TestReturnsWithoutError(t *testing.T) {
+	is := is.New(t)
+
+	w, _, backend := newMemWorker(t, "pair", func(a int) (int, string) {
+		return a, "x"
+	})
+	is.NoErr(w.execute(context.Background(), task.NewTask(nil, "pair", 1)))
+	is.Equal(len(backend.results), 1)
+	is.Equal(backend.results[0].Results, []interface{}{1, "x"})
+	is.NoErr(backend.results[0].Error)
+}
+
+func TestSubmitInterceptors(t *testing.T) {
+	is := is.New(t)
+
+	broker := &memBroker{}
+	app := NewApp(broker, &memBackend{}, WithSubmitInterceptors(
+		func(ctx context.Context, t *task.Task, next SubmitHandler) error {
+			if t.Name == "" {
+				return errors.New("task without name")
+			}
+			return next(ctx, t)
+		},
+		func(ctx context.Context, t *task.Task, next SubmitHandler) error {
+			t.Args = append(t.Args, "tenant-a")
+			return next(ctx, t)
+		}))
+
+	_, err := app.SubmitTask(context.Background(), task.NewTask(nil, "login", "user"))
+	is.NoErr(err)
+	is.Equal(len(broker.tasks), 1)
+	is.Equal(broker.tasks[0].Args, []interface{}{"user", "tenant-a"})
+
+	_, err = app.SubmitTask(context.Background(), task.NewTask(nil, ""))
+	is.Err(err)
+	is.Equal(len(broker.tasks), 1)
+}
@@ -1,6 +1,32 @@
 package asq
 
+import (
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/marshaller"
+)
+
 type Invoker interface {
 	Invoke(interface{}, []interface{}) ([]interface{}, error)
 	Return(interface{}, []interface{}) ([]interface{}, error)
 }
+
+// 需要参数保持原始类型的 Invoker（比如 lazyInvoker）实现该接口
+type typeStrictInvoker interface {
+	RequireTypes() bool
+}
+
+// checkInvoker 检查 Invoker 能否处理 Marshaller 解码出来的参数
+func checkInvoker(vk Invoker, m marshaller.Marshaller) error {
+	if vk == nil || m == nil {
+		return nil
+	}
+
+	strict, ok := vk.(typeStrictInvoker)
+	if !ok || !strict.RequireTypes() {
+		return nil
+	}
+	if tp, ok := m.(marshaller.TypePreserver); ok && tp.PreserveTypes() {
+		return nil
+	}
+	return errors.Errorf("invoker %T requires a type preserving marshaller, %T is not", vk, m)
+}
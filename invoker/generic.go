@@ -1,18 +1,43 @@
 package invoker
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
-	"github.com/golang/glog"
+	"github.com/zigzed/asq/log"
 )
 
 // 通用但是性能比较慢的函数调用参数和结果的反射处理
-type genericInvoker struct{}
+type genericInvoker struct {
+	logger log.Logger
+}
+
+type GenericOption func(*genericInvoker)
 
-func NewGenericInvoker() *genericInvoker {
-	return &genericInvoker{}
+// WithLogger sets the logger of the conversion warnings, log.Default() by
+// default. The worker passes the logger of its app.
+func WithLogger(l log.Logger) GenericOption {
+	return func(vk *genericInvoker) {
+		vk.logger = l
+	}
+}
+
+func NewGenericInvoker(opts ...GenericOption) *genericInvoker {
+	vk := &genericInvoker{}
+	for _, opt := range opts {
+		opt(vk)
+	}
+	return vk
+}
+
+func (vk genericInvoker) log() log.Logger {
+	if vk.logger == nil {
+		return log.Default()
+	}
+	return vk.logger
 }
 
 func (vk genericInvoker) Invoke(f interface{}, param []interface{}) ([]interface{}, error) {
@@ -136,10 +161,12 @@ func (vk genericInvoker) convert(v reflect.Value, t reflect.Type) (reflect.Value
 	case reflect.Map:
 		err = vk.convert2map(v, elm, t)
 	case reflect.Slice:
-		// TODO: special case for []byte
 		err = vk.convert2slice(v, elm, t)
 	default:
-		if v.Type().ConvertibleTo(t) {
+		if n, ok := vk.number(v); ok {
+			// json.Number 需要按照目标类型解析，避免精度丢失
+			err = vk.convert2number(n, elm)
+		} else if v.Type().ConvertibleTo(t) {
 			// gob/json encoding can't handle pointer to value.
 			// pointer, or pointer to value would both be converted to value.
 			//
@@ -162,6 +189,42 @@ func (vk genericInvoker) convert(v reflect.Value, t reflect.Type) (reflect.Value
 	return ret, err
 }
 
+func (vk genericInvoker) number(v reflect.Value) (json.Number, bool) {
+	if !v.CanInterface() {
+		return "", false
+	}
+	n, ok := v.Interface().(json.Number)
+	return n, ok
+}
+
+func (vk genericInvoker) convert2number(n json.Number, r reflect.Value) error {
+	switch r.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(string(n), 10, r.Type().Bits())
+		if err != nil {
+			return err
+		}
+		r.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(string(n), 10, r.Type().Bits())
+		if err != nil {
+			return err
+		}
+		r.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(n), r.Type().Bits())
+		if err != nil {
+			return err
+		}
+		r.SetFloat(f)
+	case reflect.String:
+		r.SetString(string(n))
+	default:
+		return fmt.Errorf("unable to convert json number to %v", r.Kind().String())
+	}
+	return nil
+}
+
 func (vk genericInvoker) convert2slice(v, r reflect.Value, rt reflect.Type) (err error) {
 	r.Set(reflect.MakeSlice(rt, 0, v.Len()))
 	for i := 0; i < v.Len(); i++ {
@@ -241,7 +304,7 @@ func (vk genericInvoker) convert2struct(v, r reflect.Value, rt reflect.Type) (er
 			}
 			if mv = v.MapIndex(reflect.ValueOf(key)); !mv.IsValid() {
 				if !omitempty {
-					glog.Infof("[ASQ] value of %s:%s returned from map invalid", rt.Name(), key)
+					vk.log().Info("asq: struct field missing in map", "type", rt.Name(), "field", key)
 					// fmt.Printf("[ASQ] value of %s:%s returned from map invalid", rt.Name(), key)
 				}
 				continue
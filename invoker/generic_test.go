@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"emperror.dev/errors"
 	"github.com/cheekybits/is"
@@ -104,3 +106,33 @@ func TestAddElement(t *testing.T) {
 	is.NoErr(err)
 	fmt.Printf("output: %v\n", string(output))
 }
+
+func TestJsonNumber(t *testing.T) {
+	is := is.New(t)
+
+	// 字符串原样转换为 []byte，JsonSafeMarshaller 解码时已经还原了 []byte 参数
+	inputs := `[9007199254740993, 18446744073709551615, "{\"a\": 1}", 1000000000, 7]`
+
+	var args []interface{}
+	dec := json.NewDecoder(strings.NewReader(inputs))
+	dec.UseNumber()
+	is.NoErr(dec.Decode(&args))
+
+	var (
+		id  int64
+		u   uint64
+		buf json.RawMessage
+	)
+	testFunc2 := func(a int64, b uint64, c json.RawMessage, d time.Duration, p *int64) error {
+		id, u, buf = a, b, c
+		is.Equal(d, time.Second)
+		is.Equal(*p, int64(7))
+		return nil
+	}
+
+	_, err := NewGenericInvoker().Invoke(testFunc2, args)
+	is.NoErr(err)
+	is.Equal(id, int64(9007199254740993))
+	is.Equal(u, uint64(18446744073709551615))
+	is.Equal(string(buf), `{"a": 1}`)
+}
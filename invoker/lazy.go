@@ -7,7 +7,8 @@ import (
 
 /*
  A less generic Invoker that can handle pointer with different level.
- This Invoker can only work with GobMarshaller and JsonSafeMarshaller.
+ This Invoker can only work with marshallers preserving the argument types,
+ like GobMarshaller, MsgpackMarshaller and JsonSafeMarshaller.
 */
 type lazyInvoker struct{}
 
@@ -15,6 +16,12 @@ func NewLazyInvoker() *lazyInvoker {
 	return &lazyInvoker{}
 }
 
+// RequireTypes reports that arguments must be decoded into their original
+// types, see marshaller.TypePreserver.
+func (vk lazyInvoker) RequireTypes() bool {
+	return true
+}
+
 func (vk lazyInvoker) Invoke(f interface{}, param []interface{}) ([]interface{}, error) {
 	var (
 		funcT = reflect.TypeOf(f)
@@ -48,7 +55,7 @@ func (vk lazyInvoker) Invoke(f interface{}, param []interface{}) ([]interface{},
 		if v.CanInterface() {
 			out = append(out, v.Interface())
 		} else {
-			return nil, fmt.Errorf("unable to convert to interface{} for %d, %v", k, v)
+			return nil, fmt.Errorf("unable to convert to interface{} for %d, %v", k, v.Type())
 		}
 	}
 
@@ -72,7 +79,7 @@ func (vk lazyInvoker) Return(f interface{}, returns []interface{}) ([]interface{
 			if r = *vk.toPointer(t, reflect.ValueOf(v)); r.CanInterface() {
 				returns[k] = r.Interface()
 			} else {
-				return nil, fmt.Errorf("can't interface of %v from %d:%v", r, k, v)
+				return nil, fmt.Errorf("can't interface of %v from %d:%T", r.Type(), k, v)
 			}
 		}
 	}
@@ -0,0 +1,289 @@
+package invoker
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// TypedInvoker 是由 asqgen 按函数签名生成的调用桩，避免每次调用都走反射
+type TypedInvoker interface {
+	Invoke(interface{}, []interface{}) ([]interface{}, error)
+	Return(interface{}, []interface{}) ([]interface{}, error)
+}
+
+var typed = struct {
+	sync.RWMutex
+	vk map[reflect.Type]TypedInvoker
+}{
+	vk: make(map[reflect.Type]TypedInvoker),
+}
+
+// RegisterTyped registers vk for all functions with the same signature as fn.
+// fn is usually a typed nil, e.g. (func(int) (int, error))(nil).
+func RegisterTyped(fn interface{}, vk TypedInvoker) {
+	typed.Lock()
+	defer typed.Unlock()
+
+	typed.vk[reflect.TypeOf(fn)] = vk
+}
+
+// LookupTyped returns the generated invoker for the signature of fn.
+func LookupTyped(fn interface{}) (TypedInvoker, bool) {
+	typed.RLock()
+	defer typed.RUnlock()
+
+	vk, ok := typed.vk[reflect.TypeOf(fn)]
+	return vk, ok
+}
+
+// Decode converts val into out, which must be a pointer. It is the fallback
+// used by generated invokers for types without a dedicated conversion.
+func Decode(val interface{}, out interface{}) error {
+	p := reflect.ValueOf(out)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return fmt.Errorf("decode into non-pointer %T", out)
+	}
+
+	v, err := genericInvoker{}.from(val, p.Type().Elem())
+	if err != nil {
+		return err
+	}
+	p.Elem().Set(v)
+	return nil
+}
+
+func ToString(val interface{}) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	}
+	var s string
+	err := Decode(val, &s)
+	return s, err
+}
+
+func ToBool(val interface{}) (bool, error) {
+	switch v := val.(type) {
+	case bool:
+		return v, nil
+	case nil:
+		return false, nil
+	}
+	var b bool
+	err := Decode(val, &b)
+	return b, err
+}
+
+func ToInt(val interface{}) (int, error) {
+	if v, ok := val.(int); ok {
+		return v, nil
+	}
+	v, err := toInt64(val, strconv.IntSize)
+	return int(v), err
+}
+
+func ToInt8(val interface{}) (int8, error) {
+	v, err := toInt64(val, 8)
+	return int8(v), err
+}
+
+func ToInt16(val interface{}) (int16, error) {
+	v, err := toInt64(val, 16)
+	return int16(v), err
+}
+
+func ToInt32(val interface{}) (int32, error) {
+	v, err := toInt64(val, 32)
+	return int32(v), err
+}
+
+func ToInt64(val interface{}) (int64, error) {
+	return toInt64(val, 64)
+}
+
+func ToUint(val interface{}) (uint, error) {
+	if v, ok := val.(uint); ok {
+		return v, nil
+	}
+	v, err := toUint64(val, strconv.IntSize)
+	return uint(v), err
+}
+
+func ToUint8(val interface{}) (uint8, error) {
+	v, err := toUint64(val, 8)
+	return uint8(v), err
+}
+
+func ToUint16(val interface{}) (uint16, error) {
+	v, err := toUint64(val, 16)
+	return uint16(v), err
+}
+
+func ToUint32(val interface{}) (uint32, error) {
+	v, err := toUint64(val, 32)
+	return uint32(v), err
+}
+
+func ToUint64(val interface{}) (uint64, error) {
+	return toUint64(val, 64)
+}
+
+func ToFloat32(val interface{}) (float32, error) {
+	v, err := ToFloat64(val)
+	return float32(v), err
+}
+
+func ToFloat64(val interface{}) (float64, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case nil:
+		return 0, nil
+	}
+	return 0, fmt.Errorf("unable to convert %T to float64", val)
+}
+
+func toInt64(val interface{}, bits int) (int64, error) {
+	var r int64
+	switch v := val.(type) {
+	case int:
+		r = int64(v)
+	case int8:
+		r = int64(v)
+	case int16:
+		r = int64(v)
+	case int32:
+		r = int64(v)
+	case int64:
+		r = v
+	case uint:
+		r = int64(v)
+	case uint8:
+		r = int64(v)
+	case uint16:
+		r = int64(v)
+	case uint32:
+		r = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("value %d overflows int%d", v, bits)
+		}
+		r = int64(v)
+	case float32:
+		return floatToInt64(float64(v), bits)
+	case float64:
+		return floatToInt64(v, bits)
+	case json.Number:
+		i, err := strconv.ParseInt(string(v), 10, bits)
+		if err != nil {
+			return 0, err
+		}
+		r = i
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unable to convert %T to int%d", val, bits)
+	}
+
+	if bits < 64 && (r < -(1<<(bits-1)) || r > 1<<(bits-1)-1) {
+		return 0, fmt.Errorf("value %d overflows int%d", r, bits)
+	}
+	return r, nil
+}
+
+// floatToInt64 converts the integral floats only, json decodes all numbers as
+// float64, so 1.5 or 1e20 is an error rather than truncated.
+func floatToInt64(v float64, bits int) (int64, error) {
+	if v != math.Trunc(v) {
+		return 0, fmt.Errorf("value %v is not an integer", v)
+	}
+	// -2^(bits-1) <= v < 2^(bits-1)
+	if v < -math.Ldexp(1, bits-1) || v >= math.Ldexp(1, bits-1) {
+		return 0, fmt.Errorf("value %v overflows int%d", v, bits)
+	}
+	return int64(v), nil
+}
+
+func floatToUint64(v float64, bits int) (uint64, error) {
+	if v != math.Trunc(v) {
+		return 0, fmt.Errorf("value %v is not an integer", v)
+	}
+	if v < 0 {
+		return 0, fmt.Errorf("negative value %v for uint%d", v, bits)
+	}
+	if v >= math.Ldexp(1, bits) {
+		return 0, fmt.Errorf("value %v overflows uint%d", v, bits)
+	}
+	return uint64(v), nil
+}
+
+func toUint64(val interface{}, bits int) (uint64, error) {
+	var r uint64
+	switch v := val.(type) {
+	case uint:
+		r = uint64(v)
+	case uint8:
+		r = uint64(v)
+	case uint16:
+		r = uint64(v)
+	case uint32:
+		r = uint64(v)
+	case uint64:
+		r = v
+	case int, int8, int16, int32, int64:
+		i, _ := toInt64(v, 64)
+		if i < 0 {
+			return 0, fmt.Errorf("negative value %d for uint%d", i, bits)
+		}
+		r = uint64(i)
+	case float32:
+		return floatToUint64(float64(v), bits)
+	case float64:
+		return floatToUint64(v, bits)
+	case json.Number:
+		u, err := strconv.ParseUint(string(v), 10, bits)
+		if err != nil {
+			return 0, err
+		}
+		r = u
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unable to convert %T to uint%d", val, bits)
+	}
+
+	if bits < 64 && r > 1<<bits-1 {
+		return 0, fmt.Errorf("value %d overflows uint%d", r, bits)
+	}
+	return r, nil
+}
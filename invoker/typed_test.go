@@ -0,0 +1,91 @@
+package invoker
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+type testTyped struct{}
+
+func (testTyped) Invoke(f interface{}, param []interface{}) ([]interface{}, error) {
+	a0, err := ToInt(param[0])
+	if err != nil {
+		return nil, err
+	}
+	r0, r1 := f.(func(int) (int, error))(a0)
+	return []interface{}{r0, r1}, nil
+}
+
+func (testTyped) Return(f interface{}, returns []interface{}) ([]interface{}, error) {
+	return returns, nil
+}
+
+func TestTypedLookup(t *testing.T) {
+	is := is.New(t)
+
+	double := func(i int) (int, error) { return i * 2, nil }
+	_, ok := LookupTyped(double)
+	is.False(ok)
+
+	RegisterTyped((func(int) (int, error))(nil), testTyped{})
+	vk, ok := LookupTyped(double)
+	is.True(ok)
+
+	rs, err := vk.Invoke(double, []interface{}{float64(21)})
+	is.NoErr(err)
+	is.Equal(rs[0], 42)
+	is.Nil(rs[1])
+}
+
+func TestTypedConvert(t *testing.T) {
+	is := is.New(t)
+
+	i, err := ToInt64(json.Number("9007199254740993"))
+	is.NoErr(err)
+	is.Equal(i, int64(9007199254740993))
+
+	_, err = ToInt8(float64(300))
+	is.Err(err)
+
+	_, err = ToUint(-1)
+	is.Err(err)
+
+	u, err := ToUint16(float64(65535))
+	is.NoErr(err)
+	is.Equal(u, uint16(65535))
+
+	// 浮点数只接受范围内的整数，不截断
+	i8, err := ToInt8(float64(-128))
+	is.NoErr(err)
+	is.Equal(i8, int8(-128))
+	_, err = ToInt8(float64(128))
+	is.Err(err)
+	_, err = ToInt(1.5)
+	is.Err(err)
+	_, err = ToInt64(float32(-0.5))
+	is.Err(err)
+	_, err = ToInt64(1e19)
+	is.Err(err)
+	_, err = ToInt64(math.NaN())
+	is.Err(err)
+	_, err = ToUint(float64(-1))
+	is.Err(err)
+	_, err = ToUint64(1e20)
+	is.Err(err)
+	_, err = ToUint64(math.Inf(1))
+	is.Err(err)
+	_, err = ToUint32(2.5)
+	is.Err(err)
+	u64, err := ToUint64(float64(1 << 63))
+	is.NoErr(err)
+	is.Equal(u64, uint64(1<<63))
+
+	var s testStruct1
+	err = Decode(map[string]interface{}{"A": "a", "B": float64(2)}, &s)
+	is.NoErr(err)
+	is.Equal(s.A, "a")
+	is.Equal(s.B, 2)
+}
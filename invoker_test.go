@@ -0,0 +1,70 @@
+package asq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/invoker"
+	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/task"
+)
+
+type typePreservingMarshaller struct {
+	marshaller.JsonMarshaller
+}
+
+func (typePreservingMarshaller) PreserveTypes() bool {
+	return true
+}
+
+func TestRegisterInvoker(t *testing.T) {
+	is := is.New(t)
+
+	app := NewApp(nil, nil,
+		WithMarshaller(marshaller.NewJsonMarshaller()),
+		WithInvoker(invoker.NewLazyInvoker()))
+	is.Err(app.Register("testA", testA))
+	is.NoErr(app.Register("testA", testA, WithHandlerInvoker(invoker.NewGenericInvoker())))
+
+	app = NewApp(nil, nil, WithMarshaller(marshaller.NewJsonMarshaller()))
+	is.NoErr(app.Register("testB", testB))
+	is.Err(app.Register("testC", testC, WithHandlerInvoker(invoker.NewLazyInvoker())))
+
+	// 未指定 marshaller 时按 JSON 检查
+	app = NewApp(nil, nil, WithInvoker(invoker.NewLazyInvoker()))
+	is.Err(app.Register("testC", testC))
+
+	app = NewApp(nil, nil,
+		WithMarshaller(typePreservingMarshaller{}),
+		WithInvoker(invoker.NewLazyInvoker()))
+	is.NoErr(app.Register("testC", testC))
+}
+
+type namedInvoker struct {
+	name  string
+	calls *[]string
+}
+
+func (vk namedInvoker) Invoke(fn interface{}, args []interface{}) ([]interface{}, error) {
+	*vk.calls = append(*vk.calls, vk.name)
+	return []interface{}{nil}, nil
+}
+
+func (vk namedInvoker) Return(fn interface{}, returns []interface{}) ([]interface{}, error) {
+	return returns, nil
+}
+
+func TestInvokerPrecedence(t *testing.T) {
+	is := is.New(t)
+
+	var calls []string
+	fn := func(s string, n uint16) error { return nil }
+	invoker.RegisterTyped(fn, namedInvoker{"typed", &calls})
+
+	w, _, _ := newMemWorker(t, "typed", fn)
+	is.NoErr(w.execute(context.Background(), task.NewTask(nil, "typed", "a", 1)))
+	w, _, _ = newMemWorker(t, "typed", fn, WithInvoker(namedInvoker{"app", &calls}))
+	is.NoErr(w.execute(context.Background(), task.NewTask(nil, "typed", "a", 1)))
+	is.Equal(calls, []string{"typed", "app"})
+}
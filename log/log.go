@@ -0,0 +1,153 @@
+// Package log is the structured logger of asq. Messages carry key/value
+// fields, loggers derived with With add fields to all their messages, e.g.
+// the id and name of the task being executed.
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+)
+
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+	With(keyvals ...interface{}) Logger
+}
+
+type holder struct {
+	Logger
+}
+
+var std atomic.Value
+
+func init() {
+	std.Store(holder{NewGlogLogger()})
+}
+
+// Default returns the logger of packages not bound to an App, like the
+// invoker, glog by default.
+func Default() Logger {
+	return std.Load().(holder).Logger
+}
+
+// SetDefault replaces the default logger.
+func SetDefault(l Logger) {
+	std.Store(holder{l})
+}
+
+// glogLogger 把字段格式化为 key=value 追加在消息后面
+type glogLogger struct {
+	fields []interface{}
+}
+
+func NewGlogLogger() *glogLogger {
+	return &glogLogger{}
+}
+
+func (gl *glogLogger) Debug(msg string, keyvals ...interface{}) {
+	if glog.V(1) {
+		glog.InfoDepth(1, format(msg, gl.fields, keyvals))
+	}
+}
+
+func (gl *glogLogger) Info(msg string, keyvals ...interface{}) {
+	glog.InfoDepth(1, format(msg, gl.fields, keyvals))
+}
+
+func (gl *glogLogger) Warn(msg string, keyvals ...interface{}) {
+	glog.WarningDepth(1, format(msg, gl.fields, keyvals))
+}
+
+func (gl *glogLogger) Error(msg string, keyvals ...interface{}) {
+	glog.ErrorDepth(1, format(msg, gl.fields, keyvals))
+}
+
+func (gl *glogLogger) With(keyvals ...interface{}) Logger {
+	return &glogLogger{fields: join(gl.fields, keyvals)}
+}
+
+// Printf is the printf style logger of earlier versions of asq.
+type Printf interface {
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type printfLogger struct {
+	p      Printf
+	fields []interface{}
+}
+
+// FromPrintf adapts a printf style logger, the fields are formatted into the
+// message and warnings are logged as errors.
+func FromPrintf(p Printf) *printfLogger {
+	return &printfLogger{p: p}
+}
+
+func (pl *printfLogger) Debug(msg string, keyvals ...interface{}) {}
+
+func (pl *printfLogger) Info(msg string, keyvals ...interface{}) {
+	pl.p.Infof("%s", format(msg, pl.fields, keyvals))
+}
+
+func (pl *printfLogger) Warn(msg string, keyvals ...interface{}) {
+	pl.p.Errorf("%s", format(msg, pl.fields, keyvals))
+}
+
+func (pl *printfLogger) Error(msg string, keyvals ...interface{}) {
+	pl.p.Errorf("%s", format(msg, pl.fields, keyvals))
+}
+
+func (pl *printfLogger) With(keyvals ...interface{}) Logger {
+	return &printfLogger{p: pl.p, fields: join(pl.fields, keyvals)}
+}
+
+type nopLogger struct{}
+
+// NewNopLogger discards all messages.
+func NewNopLogger() nopLogger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, keyvals ...interface{}) {}
+func (nopLogger) Info(msg string, keyvals ...interface{})  {}
+func (nopLogger) Warn(msg string, keyvals ...interface{})  {}
+func (nopLogger) Error(msg string, keyvals ...interface{}) {}
+
+func (nl nopLogger) With(keyvals ...interface{}) Logger {
+	return nl
+}
+
+func join(fields, keyvals []interface{}) []interface{} {
+	joined := make([]interface{}, 0, len(fields)+len(keyvals))
+	return append(append(joined, fields...), keyvals...)
+}
+
+func format(msg string, fields, keyvals []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(msg)
+	for _, kvs := range [][]interface{}{fields, keyvals} {
+		for i := 0; i < len(kvs); i += 2 {
+			sb.WriteByte(' ')
+			if i+1 == len(kvs) {
+				// 缺少 value 的 key
+				fmt.Fprintf(&sb, "!BADKEY=%s", value(kvs[i]))
+				break
+			}
+			fmt.Fprintf(&sb, "%v=%s", kvs[i], value(kvs[i+1]))
+		}
+	}
+	return sb.String()
+}
+
+func value(v interface{}) string {
+	s := fmt.Sprintf("%v", v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
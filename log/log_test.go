@@ -0,0 +1,47 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+type printf struct {
+	lines []string
+}
+
+func (p *printf) Infof(format string, args ...interface{}) {
+	p.lines = append(p.lines, "I "+fmt.Sprintf(format, args...))
+}
+
+func (p *printf) Errorf(format string, args ...interface{}) {
+	p.lines = append(p.lines, "E "+fmt.Sprintf(format, args...))
+}
+
+func TestFormat(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(format("started", nil, nil), "started")
+	is.Equal(format("failed", []interface{}{"task", "add", "attempt", 2},
+		[]interface{}{"error", errors.New("connection refused"), "empty", ""}),
+		`failed task=add attempt=2 error="connection refused" empty=""`)
+	is.Equal(format("odd", nil, []interface{}{"a", 1, "b"}), "odd a=1 !BADKEY=b")
+}
+
+func TestPrintf(t *testing.T) {
+	is := is.New(t)
+
+	p := &printf{}
+	l := FromPrintf(p).With("task", "add")
+	l.Debug("hidden")
+	l.Info("started", "attempt", 1)
+	l.With("id", "x").Warn("retry")
+	l.Error("failed")
+	is.Equal(p.lines, []string{
+		"I started task=add attempt=1",
+		"E retry task=add id=x",
+		"E failed task=add",
+	})
+}
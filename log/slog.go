@@ -0,0 +1,37 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+// NewSlogLogger logs to l, the fields become slog attributes.
+func NewSlogLogger(l *slog.Logger) *slogLogger {
+	return &slogLogger{l: l}
+}
+
+func (sl *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	sl.l.Log(context.Background(), slog.LevelDebug, msg, keyvals...)
+}
+
+func (sl *slogLogger) Info(msg string, keyvals ...interface{}) {
+	sl.l.Log(context.Background(), slog.LevelInfo, msg, keyvals...)
+}
+
+func (sl *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	sl.l.Log(context.Background(), slog.LevelWarn, msg, keyvals...)
+}
+
+func (sl *slogLogger) Error(msg string, keyvals ...interface{}) {
+	sl.l.Log(context.Background(), slog.LevelError, msg, keyvals...)
+}
+
+func (sl *slogLogger) With(keyvals ...interface{}) Logger {
+	return &slogLogger{l: sl.l.With(keyvals...)}
+}
@@ -0,0 +1,28 @@
+//go:build go1.21
+
+package log
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/cheekybits/is"
+)
+
+func TestSlog(t *testing.T) {
+	is := is.New(t)
+
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})))
+	l.Debug("hidden")
+	l.With("task", "add").Warn("retry", "attempt", 2)
+	is.Equal(buf.String(), "level=WARN msg=retry task=add attempt=2\n")
+}
@@ -1,27 +1,26 @@
 package asq
 
 import (
-	"fmt"
+	"context"
 
-	"github.com/golang/glog"
+	"github.com/zigzed/asq/log"
 )
 
-type Logger interface {
-	Infof(format string, args ...interface{})
-	Errorf(format string, args ...interface{})
-	Fatalf(format string, args ...interface{})
-}
-
-type defaultLogger struct{}
+// Logger logs messages with key/value fields, see package log for the glog,
+// slog and printf implementations.
+type Logger = log.Logger
 
-func (dl defaultLogger) Infof(format string, args ...interface{}) {
-	glog.InfoDepth(1, fmt.Sprintf(format, args...))
-}
+type loggerKey struct{}
 
-func (dl defaultLogger) Errorf(format string, args ...interface{}) {
-	glog.ErrorDepth(1, fmt.Sprintf(format, args...))
+// LoggerFromContext returns the logger of the task being executed, with the
+// task id, name, attempt and worker as fields.
+func LoggerFromContext(ctx context.Context) Logger {
+	if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return l
+	}
+	return log.Default()
 }
 
-func (dl defaultLogger) Fatalf(format string, args ...interface{}) {
-	glog.FatalDepth(1, fmt.Sprintf(format, args...))
+func contextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
 }
@@ -0,0 +1,65 @@
+package asq
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/log"
+	"github.com/zigzed/asq/task"
+)
+
+type memLogger struct {
+	lines *[]string
+}
+
+func (ml memLogger) Infof(format string, args ...interface{}) {
+	*ml.lines = append(*ml.lines, fmt.Sprintf(format, args...))
+}
+
+func (ml memLogger) Errorf(format string, args ...interface{}) {
+	*ml.lines = append(*ml.lines, fmt.Sprintf(format, args...))
+}
+
+func TestTaskLogger(t *testing.T) {
+	is := is.New(t)
+	std := log.Default()
+
+	var lines []string
+	w, _, _ := newMemWorker(t, "charge", func(ctx context.Context, amount int) error {
+		LoggerFromContext(ctx).Info("charging", "amount", amount)
+		return errors.New("declined")
+	}, WithLogger(log.FromPrintf(memLogger{&lines})))
+
+	t1 := task.NewTask(task.NewTaskOption(0, time.Second), "charge", 100)
+	is.NoErr(w.execute(context.Background(), t1))
+
+	fields := fmt.Sprintf("task=charge task_id=%s attempt=0 worker=%s", t1.Id, w.ID())
+	is.Equal(lines, []string{
+		"charging " + fields + " amount=100",
+		"asq: task failed " + fields + " error=declined",
+	})
+	is.Equal(LoggerFromContext(context.Background()), std)
+	// 不修改全局的 logger
+	is.Equal(log.Default(), std)
+}
+
+func TestInvokerLogger(t *testing.T) {
+	is := is.New(t)
+
+	type order struct {
+		Id    string
+		Items int
+	}
+	var lines []string
+	w, _, _ := newMemWorker(t, "ship", func(o order) error {
+		return nil
+	}, WithLogger(log.FromPrintf(memLogger{&lines})))
+
+	t1 := task.NewTask(nil, "ship", map[string]interface{}{"Id": "o1"})
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(lines, []string{"asq: struct field missing in map type=order field=Items"})
+}
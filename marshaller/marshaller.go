@@ -8,3 +8,15 @@ type Marshaller interface {
 	EncodeResult(rs []interface{}, e error) (string, error)
 	DecodeResult(buf string, args ...interface{}) (bool, error)
 }
+
+// TypePreserver is implemented by marshallers that decode arguments into
+// their original Go types, which is required by invoker.NewLazyInvoker.
+type TypePreserver interface {
+	PreserveTypes() bool
+}
+
+// ContentTyper is implemented by marshallers that can be selected by content
+// type in EnvelopeMarshaller.
+type ContentTyper interface {
+	ContentType() string
+}
@@ -0,0 +1,198 @@
+package marshaller
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"sync"
+
+	"emperror.dev/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/zigzed/asq/task"
+)
+
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// 压缩后的数据以 magic 开头，后跟一个字节的压缩算法。
+// json/gob/msgpack/protobuf 的编码结果都不会以 0 开头
+const compressMagic = "\x00asqz"
+
+// DefaultMaxDecompressed is the default limit of decompressed payloads.
+const DefaultMaxDecompressed = 64 << 20
+
+var compressAlgorithms = map[string]byte{
+	CompressGzip: 'g',
+	CompressZstd: 'z',
+}
+
+// CompressMarshaller compresses the tasks and results encoded by another
+// marshaller once they exceed a threshold. Compressed payloads are marked,
+// so payloads of any algorithm, or not compressed at all, can be decoded.
+type CompressMarshaller struct {
+	m         Marshaller
+	algorithm byte
+	threshold int
+	max       int
+
+	// zstd 的编解码器在第一次使用时创建
+	zencOnce sync.Once
+	zenc     *zstd.Encoder
+	zencErr  error
+	zdecOnce sync.Once
+	zdec     *zstd.Decoder
+	zdecErr  error
+}
+
+// NewCompressMarshaller compresses payloads of m larger than threshold bytes
+// with algorithm, CompressGzip or CompressZstd.
+func NewCompressMarshaller(m Marshaller, algorithm string, threshold int) (*CompressMarshaller, error) {
+	algo, ok := compressAlgorithms[algorithm]
+	if !ok {
+		return nil, errors.Errorf("unsupported compression algorithm %s", algorithm)
+	}
+
+	return &CompressMarshaller{
+		m:         m,
+		algorithm: algo,
+		threshold: threshold,
+		max:       DefaultMaxDecompressed,
+	}, nil
+}
+
+// WithMaxDecompressed limits the size of decompressed payloads, larger ones
+// fail to decode. It must be set before the first decode.
+func (cm *CompressMarshaller) WithMaxDecompressed(max int) *CompressMarshaller {
+	cm.max = max
+	return cm
+}
+
+// Close releases the zstd encoder and decoder.
+func (cm *CompressMarshaller) Close() error {
+	if cm.zenc != nil {
+		cm.zenc.Close()
+	}
+	if cm.zdec != nil {
+		cm.zdec.Close()
+	}
+	return nil
+}
+
+func (cm *CompressMarshaller) encoder() (*zstd.Encoder, error) {
+	cm.zencOnce.Do(func() {
+		cm.zenc, cm.zencErr = zstd.NewWriter(nil)
+		cm.zencErr = errors.Wrap(cm.zencErr, "create zstd encoder failed")
+	})
+	return cm.zenc, cm.zencErr
+}
+
+func (cm *CompressMarshaller) decoder() (*zstd.Decoder, error) {
+	cm.zdecOnce.Do(func() {
+		cm.zdec, cm.zdecErr = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(cm.max)))
+		cm.zdecErr = errors.Wrap(cm.zdecErr, "create zstd decoder failed")
+	})
+	return cm.zdec, cm.zdecErr
+}
+
+func (cm *CompressMarshaller) PreserveTypes() bool {
+	tp, ok := cm.m.(TypePreserver)
+	return ok && tp.PreserveTypes()
+}
+
+func (cm *CompressMarshaller) EncodeTask(task *task.Task) (string, error) {
+	buf, err := cm.m.EncodeTask(task)
+	if err != nil {
+		return "", err
+	}
+	return cm.compress(buf)
+}
+
+func (cm *CompressMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	buf, err := cm.decompress(buf)
+	if err != nil {
+		return nil, err
+	}
+	return cm.m.DecodeTask(buf)
+}
+
+func (cm *CompressMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	buf, err := cm.m.EncodeResult(rs, e)
+	if err != nil {
+		return "", err
+	}
+	return cm.compress(buf)
+}
+
+func (cm *CompressMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	buf, err := cm.decompress(buf)
+	if err != nil {
+		return false, err
+	}
+	return cm.m.DecodeResult(buf, args...)
+}
+
+func (cm *CompressMarshaller) compress(buf string) (string, error) {
+	if len(buf) <= cm.threshold {
+		return buf, nil
+	}
+
+	var out bytes.Buffer
+	out.WriteString(compressMagic)
+	out.WriteByte(cm.algorithm)
+
+	switch cm.algorithm {
+	case 'z':
+		zenc, err := cm.encoder()
+		if err != nil {
+			return "", err
+		}
+		out.Write(zenc.EncodeAll([]byte(buf), nil))
+	default:
+		zw := gzip.NewWriter(&out)
+		if _, err := zw.Write([]byte(buf)); err != nil {
+			return "", errors.Wrap(err, "gzip compress failed")
+		}
+		if err := zw.Close(); err != nil {
+			return "", errors.Wrap(err, "gzip compress failed")
+		}
+	}
+	return out.String(), nil
+}
+
+func (cm *CompressMarshaller) decompress(buf string) (string, error) {
+	if !strings.HasPrefix(buf, compressMagic) || len(buf) < len(compressMagic)+1 {
+		return buf, nil
+	}
+
+	data := []byte(buf[len(compressMagic)+1:])
+	switch algo := buf[len(compressMagic)]; algo {
+	case 'z':
+		zdec, err := cm.decoder()
+		if err != nil {
+			return "", err
+		}
+		out, err := zdec.DecodeAll(data, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "zstd decompress failed")
+		}
+		return string(out), nil
+	case 'g':
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", errors.Wrap(err, "gzip decompress failed")
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, int64(cm.max)+1))
+		if err != nil {
+			return "", errors.Wrap(err, "gzip decompress failed")
+		}
+		if len(out) > cm.max {
+			return "", errors.Errorf("gzip decompress failed: more than %d bytes", cm.max)
+		}
+		return string(out), nil
+	default:
+		return "", errors.Errorf("unsupported compression algorithm %q", algo)
+	}
+}
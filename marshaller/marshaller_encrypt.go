@@ -0,0 +1,154 @@
+package marshaller
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/task"
+)
+
+// 加密后的数据格式: magic, 一个字节的 key id 长度, key id, nonce, 密文。
+// magic 和 key id 作为附加数据参与认证
+const encryptMagic = "\x00asqe"
+
+// EncryptMarshaller encrypts the tasks and results encoded by another
+// marshaller with AES-GCM. The id of the key is stored with the payload, so
+// old keys can be kept for decryption while rotating to a new one.
+type EncryptMarshaller struct {
+	m         Marshaller
+	keyID     string
+	keys      map[string]cipher.AEAD
+	plaintext bool
+}
+
+// NewEncryptMarshaller encrypts payloads of m with keys[keyID]. The other keys
+// are only used to decrypt. Keys must be 16, 24 or 32 bytes for AES-128,
+// AES-192 or AES-256.
+func NewEncryptMarshaller(m Marshaller, keyID string, keys map[string][]byte) (*EncryptMarshaller, error) {
+	if _, ok := keys[keyID]; !ok {
+		return nil, errors.Errorf("encryption key %s not found", keyID)
+	}
+
+	em := &EncryptMarshaller{
+		m:     m,
+		keyID: keyID,
+		keys:  make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, errors.Errorf("invalid encryption key id %q", id)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encryption key %s", id)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encryption key %s", id)
+		}
+		em.keys[id] = aead
+	}
+	return em, nil
+}
+
+// AcceptPlaintext allows to decode payloads that are not encrypted, which is
+// needed while enabling encryption on queues with pending messages.
+func (em *EncryptMarshaller) AcceptPlaintext(accept bool) *EncryptMarshaller {
+	em.plaintext = accept
+	return em
+}
+
+func (em *EncryptMarshaller) PreserveTypes() bool {
+	tp, ok := em.m.(TypePreserver)
+	return ok && tp.PreserveTypes()
+}
+
+func (em *EncryptMarshaller) EncodeTask(task *task.Task) (string, error) {
+	buf, err := em.m.EncodeTask(task)
+	if err != nil {
+		return "", err
+	}
+	return em.encrypt(buf)
+}
+
+func (em *EncryptMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	buf, err := em.decrypt(buf)
+	if err != nil {
+		return nil, err
+	}
+	return em.m.DecodeTask(buf)
+}
+
+func (em *EncryptMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	buf, err := em.m.EncodeResult(rs, e)
+	if err != nil {
+		return "", err
+	}
+	return em.encrypt(buf)
+}
+
+func (em *EncryptMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	buf, err := em.decrypt(buf)
+	if err != nil {
+		return false, err
+	}
+	return em.m.DecodeResult(buf, args...)
+}
+
+func (em *EncryptMarshaller) encrypt(buf string) (string, error) {
+	aead := em.keys[em.keyID]
+
+	header := make([]byte, 0, len(encryptMagic)+1+len(em.keyID))
+	header = append(header, encryptMagic...)
+	header = append(header, byte(len(em.keyID)))
+	header = append(header, em.keyID...)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errors.Wrap(err, "generate nonce failed")
+	}
+
+	out := append(header, nonce...)
+	out = aead.Seal(out, nonce, []byte(buf), header)
+	return string(out), nil
+}
+
+func (em *EncryptMarshaller) decrypt(buf string) (string, error) {
+	if !strings.HasPrefix(buf, encryptMagic) {
+		if em.plaintext {
+			return buf, nil
+		}
+		return "", errors.Errorf("payload is not encrypted")
+	}
+
+	data := []byte(buf)
+	pos := len(encryptMagic)
+	if len(data) <= pos {
+		return "", errors.Errorf("encrypted payload truncated")
+	}
+	n := int(data[pos])
+	pos++
+	if len(data) < pos+n {
+		return "", errors.Errorf("encrypted payload truncated")
+	}
+	keyID := string(data[pos : pos+n])
+	pos += n
+
+	aead, ok := em.keys[keyID]
+	if !ok {
+		return "", errors.Errorf("decryption key %s not found", keyID)
+	}
+	if len(data) < pos+aead.NonceSize() {
+		return "", errors.Errorf("encrypted payload truncated")
+	}
+	header, nonce := data[:pos], data[pos:pos+aead.NonceSize()]
+
+	out, err := aead.Open(nil, nonce, data[pos+aead.NonceSize():], header)
+	if err != nil {
+		return "", errors.Wrapf(err, "decrypt payload with key %s failed", keyID)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,186 @@
+package marshaller
+
+import (
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/task"
+)
+
+// ProtocolVersion is the version of the envelope written by
+// EnvelopeMarshaller, payloads without an envelope are version 0.
+const ProtocolVersion = 1
+
+// 信封格式: magic, 一个字节的版本号, 一个字节的 content type 长度,
+// content type, payload
+const envelopeMagic = "\x00asqv"
+
+// Envelope is a decoded payload passed to the upgrade hooks.
+type Envelope struct {
+	Version     int
+	ContentType string
+	Result      bool // the payload is a result instead of a task
+	Payload     string
+}
+
+// Upgrade converts an envelope of one version into the next version, it may
+// also change the content type and the payload.
+type Upgrade func(env *Envelope) error
+
+// EnvelopeMarshaller wraps the payloads of a marshaller into an envelope with
+// the protocol version and content type, so payloads of older versions or
+// other marshallers can still be decoded. Compression and encryption should
+// wrap the EnvelopeMarshaller, not the reverse.
+type EnvelopeMarshaller struct {
+	m        Marshaller
+	ct       string
+	decoders map[string]Marshaller
+	legacy   Marshaller
+	upgrades map[int]Upgrade
+}
+
+// NewEnvelopeMarshaller encodes with m and decodes with m or any of the
+// decoders, selected by content type. All of them must implement
+// ContentTyper. Payloads without an envelope are decoded by m.
+func NewEnvelopeMarshaller(m Marshaller, decoders ...Marshaller) (*EnvelopeMarshaller, error) {
+	em := &EnvelopeMarshaller{
+		m:        m,
+		decoders: make(map[string]Marshaller),
+		legacy:   m,
+		upgrades: make(map[int]Upgrade),
+	}
+	for _, d := range append([]Marshaller{m}, decoders...) {
+		ct, ok := d.(ContentTyper)
+		if !ok {
+			return nil, errors.Errorf("marshaller %T has no content type", d)
+		}
+		if len(ct.ContentType()) > 255 {
+			return nil, errors.Errorf("content type %s too long", ct.ContentType())
+		}
+		if _, ok := em.decoders[ct.ContentType()]; !ok {
+			em.decoders[ct.ContentType()] = d
+		}
+	}
+	em.ct = m.(ContentTyper).ContentType()
+	return em, nil
+}
+
+// WithLegacy sets the marshaller of the payloads without an envelope, written
+// before the EnvelopeMarshaller was used.
+func (em *EnvelopeMarshaller) WithLegacy(m Marshaller) *EnvelopeMarshaller {
+	em.legacy = m
+	if _, ok := m.(ContentTyper); !ok {
+		em.decoders[""] = m
+	}
+	return em
+}
+
+// WithUpgrade registers the hook converting envelopes of version from into
+// version from+1. Upgrades of version 0 see payloads without an envelope with
+// the content type of the legacy marshaller.
+func (em *EnvelopeMarshaller) WithUpgrade(from int, fn Upgrade) *EnvelopeMarshaller {
+	em.upgrades[from] = fn
+	return em
+}
+
+func (em *EnvelopeMarshaller) PreserveTypes() bool {
+	tp, ok := em.m.(TypePreserver)
+	return ok && tp.PreserveTypes()
+}
+
+func (em *EnvelopeMarshaller) ContentType() string {
+	return em.ct
+}
+
+func (em *EnvelopeMarshaller) EncodeTask(task *task.Task) (string, error) {
+	buf, err := em.m.EncodeTask(task)
+	if err != nil {
+		return "", err
+	}
+	return em.seal(buf), nil
+}
+
+func (em *EnvelopeMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	m, buf, err := em.open(buf, false)
+	if err != nil {
+		return nil, err
+	}
+	return m.DecodeTask(buf)
+}
+
+func (em *EnvelopeMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	buf, err := em.m.EncodeResult(rs, e)
+	if err != nil {
+		return "", err
+	}
+	return em.seal(buf), nil
+}
+
+func (em *EnvelopeMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	m, buf, err := em.open(buf, true)
+	if err != nil {
+		return false, err
+	}
+	return m.DecodeResult(buf, args...)
+}
+
+func (em *EnvelopeMarshaller) seal(buf string) string {
+	var sb strings.Builder
+	sb.Grow(len(envelopeMagic) + 2 + len(em.ct) + len(buf))
+	sb.WriteString(envelopeMagic)
+	sb.WriteByte(ProtocolVersion)
+	sb.WriteByte(byte(len(em.ct)))
+	sb.WriteString(em.ct)
+	sb.WriteString(buf)
+	return sb.String()
+}
+
+// open parses the envelope, upgrades it to the current version and returns
+// the marshaller of its content type.
+func (em *EnvelopeMarshaller) open(buf string, result bool) (Marshaller, string, error) {
+	env, err := em.parse(buf)
+	if err != nil {
+		return nil, "", err
+	}
+	env.Result = result
+
+	if env.Version > ProtocolVersion {
+		return nil, "", errors.Errorf("unsupported protocol version %d, expect %d or older",
+			env.Version, ProtocolVersion)
+	}
+	for env.Version < ProtocolVersion {
+		if fn, ok := em.upgrades[env.Version]; ok {
+			if err := fn(env); err != nil {
+				return nil, "", errors.Wrapf(err, "upgrade from protocol version %d failed", env.Version)
+			}
+		}
+		env.Version++
+	}
+
+	m, ok := em.decoders[env.ContentType]
+	if !ok {
+		return nil, "", errors.Errorf("unsupported content type %s", env.ContentType)
+	}
+	return m, env.Payload, nil
+}
+
+func (em *EnvelopeMarshaller) parse(buf string) (*Envelope, error) {
+	if !strings.HasPrefix(buf, envelopeMagic) {
+		env := &Envelope{Payload: buf}
+		if ct, ok := em.legacy.(ContentTyper); ok {
+			env.ContentType = ct.ContentType()
+		}
+		return env, nil
+	}
+
+	pos := len(envelopeMagic)
+	if len(buf) < pos+2 || len(buf) < pos+2+int(buf[pos+1]) {
+		return nil, errors.Errorf("envelope truncated")
+	}
+	n := int(buf[pos+1])
+	return &Envelope{
+		Version:     int(buf[pos]),
+		ContentType: buf[pos+2 : pos+2+n],
+		Payload:     buf[pos+2+n:],
+	}, nil
+}
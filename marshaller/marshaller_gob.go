@@ -0,0 +1,99 @@
+package marshaller
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+// GobMarshaller keeps the concrete types of arguments and results. Types
+// other than the builtin ones must be registered by RegisterType.
+type GobMarshaller struct{}
+
+type gobResult struct {
+	Results []interface{}
+	Error   *result.Error
+}
+
+func NewGobMarshaller() *GobMarshaller {
+	return &GobMarshaller{}
+}
+
+func (gm GobMarshaller) ContentType() string {
+	return "application/x-gob"
+}
+
+func (gm GobMarshaller) PreserveTypes() bool {
+	return true
+}
+
+func (gm GobMarshaller) EncodeTask(task *task.Task) (string, error) {
+	if task == nil {
+		return "", errors.Errorf("nil is not acceptable")
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(gm.sanitize(task)); err != nil {
+		return "", errors.Wrapf(err, "gob marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	return buf.String(), nil
+}
+
+func (gm GobMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	var task task.Task
+	if err := gob.NewDecoder(bytes.NewBufferString(buf)).Decode(&task); err != nil {
+		return nil, errors.Wrapf(err, "gob unmarshal for %d bytes failed", len(buf))
+	}
+	return &task, nil
+}
+
+func (gm GobMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	r := gobResult{Results: make([]interface{}, len(rs))}
+	for i, v := range rs {
+		r.Results[i] = indirect(v)
+	}
+	r.Error = result.NewError(e)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&r); err != nil {
+		return "", errors.Wrapf(err, "gob marshal for result of %d values failed", len(rs))
+	}
+	return buf.String(), nil
+}
+
+func (gm GobMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	var r gobResult
+	if err := gob.NewDecoder(bytes.NewBufferString(buf)).Decode(&r); err != nil {
+		return false, errors.Wrapf(err, "gob unmarshal for %d bytes failed", len(buf))
+	}
+
+	for i := 0; i < len(args) && i < len(r.Results); i++ {
+		if err := assign(args[i], r.Results[i]); err != nil {
+			return false, errors.Wrapf(err, "assign result %d failed", i)
+		}
+	}
+
+	return true, r.Error.Err()
+}
+
+// sanitize makes a copy of the task tree with the arguments dereferenced,
+// gob refuses to encode nil pointers inside interfaces.
+func (gm GobMarshaller) sanitize(t *task.Task) *task.Task {
+	c := *t
+	c.Args = make([]interface{}, len(t.Args))
+	for i, v := range t.Args {
+		c.Args[i] = indirect(v)
+	}
+	c.OnSuccess = make([]*task.Task, len(t.OnSuccess))
+	for i, x := range t.OnSuccess {
+		c.OnSuccess[i] = gm.sanitize(x)
+	}
+	c.OnFailed = make([]*task.Task, len(t.OnFailed))
+	for i, x := range t.OnFailed {
+		c.OnFailed[i] = gm.sanitize(x)
+	}
+	return &c
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"emperror.dev/errors"
+	"github.com/zigzed/asq/result"
 	"github.com/zigzed/asq/task"
 )
 
@@ -14,6 +15,10 @@ func NewJsonMarshaller() *JsonMarshaller {
 	return &JsonMarshaller{}
 }
 
+func (jm JsonMarshaller) ContentType() string {
+	return "application/json"
+}
+
 func (jm JsonMarshaller) EncodeTask(task *task.Task) (string, error) {
 	if task == nil {
 		return "", errors.Errorf("nil is not acceptable")
@@ -21,7 +26,7 @@ func (jm JsonMarshaller) EncodeTask(task *task.Task) (string, error) {
 
 	buf, err := json.Marshal(task)
 	if err != nil {
-		return "", errors.Wrapf(err, "json marshal for task %v failed", task)
+		return "", errors.Wrapf(err, "json marshal for task %s, %s failed", task.Name, task.Id)
 	}
 	return string(buf), nil
 }
@@ -29,38 +34,62 @@ func (jm JsonMarshaller) EncodeTask(task *task.Task) (string, error) {
 func (jm JsonMarshaller) DecodeTask(buf string) (*task.Task, error) {
 	var task task.Task
 	if err := json.Unmarshal([]byte(buf), &task); err != nil {
-		return nil, errors.Wrapf(err, "json unmarshal for %s failed", buf)
+		return nil, errors.Wrapf(err, "json unmarshal for %d bytes failed", len(buf))
 	} else {
 		return &task, nil
 	}
 }
 
+// EncodeResult appends the error message to the results, an empty string if
+// there is no error, as older versions do. The result.Error follows the
+// message, older versions ignore it.
 func (jm JsonMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
 	if e == nil {
 		rs = append(rs, "")
 	} else {
-		rs = append(rs, e.Error())
+		rs = append(rs, e.Error(), result.NewError(e))
 	}
 
 	buf, err := json.Marshal(rs)
 	if err != nil {
-		return "", errors.Wrapf(err, "json marshal for result %v failed", rs)
+		return "", errors.Wrapf(err, "json marshal for result of %d values failed", len(rs))
 	}
 	return string(buf), nil
 }
 
 func (jm JsonMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
-	var s string
-	vals := make([]interface{}, 0, len(args)+1)
+	var msg, detail json.RawMessage
+	vals := make([]interface{}, 0, len(args)+2)
 	vals = append(vals, args...)
-	vals = append(vals, &s)
+	vals = append(vals, &msg, &detail)
 
 	if err := json.Unmarshal([]byte(buf), &vals); err != nil {
-		return false, errors.Wrapf(err, "json unmarshal for %s failed", buf)
+		return false, errors.Wrapf(err, "json unmarshal for %d bytes failed", len(buf))
+	}
+
+	if len(detail) > 0 {
+		return true, jm.decodeError(detail)
+	}
+	return true, jm.decodeError(msg)
+}
+
+// decodeError also accepts the plain error message of older versions.
+func (jm JsonMarshaller) decodeError(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil || s == "" {
+			return err
+		}
+		return fmt.Errorf("%s", s)
 	}
 
-	if s != "" {
-		return true, fmt.Errorf("%s", s)
+	var e result.Error
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return errors.Wrapf(err, "json unmarshal for error of %d bytes failed", len(raw))
 	}
-	return true, nil
+	return e.Err()
 }
@@ -0,0 +1,211 @@
+package marshaller
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+// JsonSafeMarshaller is a JSON marshaller that doesn't lose precision or
+// types. Each argument and result carries a type hint, so int64, uint64,
+// []byte, time.Time, time.Duration and types registered by RegisterType are
+// decoded exactly. Values of unregistered types keep numbers as json.Number.
+type JsonSafeMarshaller struct{}
+
+type jsonValue struct {
+	Type  string          `json:"t,omitempty"`
+	Value json.RawMessage `json:"v"`
+}
+
+// jsonSafeTask 和 task.Task 的 json 格式一致，只是参数带上了类型
+type jsonSafeTask struct {
+	task.Task
+	Args      []jsonValue
+	OnSuccess []*jsonSafeTask
+	OnFailed  []*jsonSafeTask
+}
+
+type jsonSafeResult struct {
+	Results []jsonValue   `json:"results"`
+	Error   *result.Error `json:"error,omitempty"`
+}
+
+func NewJsonSafeMarshaller() *JsonSafeMarshaller {
+	return &JsonSafeMarshaller{}
+}
+
+func (jm JsonSafeMarshaller) ContentType() string {
+	return "application/x-asq-json-safe"
+}
+
+func (jm JsonSafeMarshaller) PreserveTypes() bool {
+	return true
+}
+
+func (jm JsonSafeMarshaller) EncodeTask(task *task.Task) (string, error) {
+	if task == nil {
+		return "", errors.Errorf("nil is not acceptable")
+	}
+
+	jt, err := jm.fromTask(task)
+	if err != nil {
+		return "", errors.Wrapf(err, "json marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	buf, err := json.Marshal(jt)
+	if err != nil {
+		return "", errors.Wrapf(err, "json marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	return string(buf), nil
+}
+
+func (jm JsonSafeMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	var jt jsonSafeTask
+	if err := json.Unmarshal([]byte(buf), &jt); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal for %d bytes failed", len(buf))
+	}
+
+	task, err := jm.toTask(&jt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal for %d bytes failed", len(buf))
+	}
+	return task, nil
+}
+
+func (jm JsonSafeMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	var (
+		r   jsonSafeResult
+		err error
+	)
+	if r.Results, err = jm.encodeValues(rs); err != nil {
+		return "", errors.Wrapf(err, "json marshal for result of %d values failed", len(rs))
+	}
+	r.Error = result.NewError(e)
+
+	buf, err := json.Marshal(&r)
+	if err != nil {
+		return "", errors.Wrapf(err, "json marshal for result of %d values failed", len(rs))
+	}
+	return string(buf), nil
+}
+
+func (jm JsonSafeMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	var r jsonSafeResult
+	if err := json.Unmarshal([]byte(buf), &r); err != nil {
+		return false, errors.Wrapf(err, "json unmarshal for %d bytes failed", len(buf))
+	}
+
+	for i := 0; i < len(args) && i < len(r.Results); i++ {
+		if err := jm.decodeInto(r.Results[i], args[i]); err != nil {
+			return false, errors.Wrapf(err, "decode result %d failed", i)
+		}
+	}
+
+	return true, r.Error.Err()
+}
+
+func (jm JsonSafeMarshaller) fromTask(t *task.Task) (*jsonSafeTask, error) {
+	var err error
+
+	jt := &jsonSafeTask{Task: *t}
+	jt.Task.Args, jt.Task.OnSuccess, jt.Task.OnFailed = nil, nil, nil
+	if jt.Args, err = jm.encodeValues(t.Args); err != nil {
+		return nil, err
+	}
+	for _, x := range t.OnSuccess {
+		link, err := jm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		jt.OnSuccess = append(jt.OnSuccess, link)
+	}
+	for _, x := range t.OnFailed {
+		link, err := jm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		jt.OnFailed = append(jt.OnFailed, link)
+	}
+	return jt, nil
+}
+
+func (jm JsonSafeMarshaller) toTask(jt *jsonSafeTask) (*task.Task, error) {
+	t := jt.Task
+	t.Args = make([]interface{}, len(jt.Args))
+	for i, v := range jt.Args {
+		val, err := jm.decodeValue(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode argument %d of %s failed", i, t.Name)
+		}
+		t.Args[i] = val
+	}
+	for _, x := range jt.OnSuccess {
+		link, err := jm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnSuccess = append(t.OnSuccess, link)
+	}
+	for _, x := range jt.OnFailed {
+		link, err := jm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnFailed = append(t.OnFailed, link)
+	}
+	return &t, nil
+}
+
+func (jm JsonSafeMarshaller) encodeValues(vals []interface{}) ([]jsonValue, error) {
+	out := make([]jsonValue, len(vals))
+	for i, v := range vals {
+		v = indirect(v)
+
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i].Value = raw
+		if v != nil {
+			out[i].Type, _ = lookupName(reflect.TypeOf(v))
+		}
+	}
+	return out, nil
+}
+
+func (jm JsonSafeMarshaller) decodeValue(v jsonValue) (interface{}, error) {
+	// 嵌套在 interface{} 中的数字也使用 json.Number
+	dec := json.NewDecoder(bytes.NewReader(v.Value))
+	dec.UseNumber()
+
+	if t, ok := lookupType(v.Type); ok {
+		p := reflect.New(t)
+		if err := dec.Decode(p.Interface()); err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	}
+
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+// decodeInto decodes v into the pointer dst, the type hint is only needed
+// when dst doesn't tell the type.
+func (jm JsonSafeMarshaller) decodeInto(v jsonValue, dst interface{}) error {
+	if p, ok := dst.(*interface{}); ok {
+		val, err := jm.decodeValue(v)
+		if err != nil {
+			return err
+		}
+		*p = val
+		return nil
+	}
+	return json.Unmarshal(v.Value, dst)
+}
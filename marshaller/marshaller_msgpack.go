@@ -0,0 +1,203 @@
+package marshaller
+
+import (
+	"reflect"
+
+	"emperror.dev/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+// MsgpackMarshaller keeps the concrete types of arguments and results by
+// tagging each value with its registered type name, see RegisterType.
+// Values of unregistered types are decoded into generic maps and slices.
+type MsgpackMarshaller struct{}
+
+type msgpackValue struct {
+	Type  string             `msgpack:"t,omitempty"`
+	Value msgpack.RawMessage `msgpack:"v,omitempty"`
+}
+
+type msgpackTask struct {
+	Task      *task.Task     `msgpack:"task"`
+	Args      []msgpackValue `msgpack:"args"`
+	OnSuccess []*msgpackTask `msgpack:"success,omitempty"`
+	OnFailed  []*msgpackTask `msgpack:"failed,omitempty"`
+}
+
+type msgpackResult struct {
+	Results []msgpackValue `msgpack:"results"`
+	Error   *result.Error  `msgpack:"error,omitempty"`
+}
+
+func NewMsgpackMarshaller() *MsgpackMarshaller {
+	return &MsgpackMarshaller{}
+}
+
+func (mm MsgpackMarshaller) ContentType() string {
+	return "application/msgpack"
+}
+
+func (mm MsgpackMarshaller) PreserveTypes() bool {
+	return true
+}
+
+func (mm MsgpackMarshaller) EncodeTask(task *task.Task) (string, error) {
+	if task == nil {
+		return "", errors.Errorf("nil is not acceptable")
+	}
+
+	mt, err := mm.fromTask(task)
+	if err != nil {
+		return "", errors.Wrapf(err, "msgpack marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	buf, err := msgpack.Marshal(mt)
+	if err != nil {
+		return "", errors.Wrapf(err, "msgpack marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	return string(buf), nil
+}
+
+func (mm MsgpackMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	var mt msgpackTask
+	if err := msgpack.Unmarshal([]byte(buf), &mt); err != nil {
+		return nil, errors.Wrapf(err, "msgpack unmarshal for %d bytes failed", len(buf))
+	}
+
+	task, err := mm.toTask(&mt)
+	if err != nil {
+		return nil, errors.Wrapf(err, "msgpack unmarshal for %d bytes failed", len(buf))
+	}
+	return task, nil
+}
+
+func (mm MsgpackMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	var (
+		r   msgpackResult
+		err error
+	)
+	if r.Results, err = mm.encodeValues(rs); err != nil {
+		return "", errors.Wrapf(err, "msgpack marshal for result of %d values failed", len(rs))
+	}
+	r.Error = result.NewError(e)
+
+	buf, err := msgpack.Marshal(&r)
+	if err != nil {
+		return "", errors.Wrapf(err, "msgpack marshal for result of %d values failed", len(rs))
+	}
+	return string(buf), nil
+}
+
+func (mm MsgpackMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	var r msgpackResult
+	if err := msgpack.Unmarshal([]byte(buf), &r); err != nil {
+		return false, errors.Wrapf(err, "msgpack unmarshal for %d bytes failed", len(buf))
+	}
+
+	for i := 0; i < len(args) && i < len(r.Results); i++ {
+		v, err := mm.decodeValue(r.Results[i])
+		if err != nil {
+			return false, errors.Wrapf(err, "decode result %d failed", i)
+		}
+		if err := assign(args[i], v); err != nil {
+			return false, errors.Wrapf(err, "assign result %d failed", i)
+		}
+	}
+
+	return true, r.Error.Err()
+}
+
+func (mm MsgpackMarshaller) fromTask(t *task.Task) (*msgpackTask, error) {
+	var err error
+
+	c := *t
+	c.Args, c.OnSuccess, c.OnFailed = nil, nil, nil
+	mt := &msgpackTask{Task: &c}
+	if mt.Args, err = mm.encodeValues(t.Args); err != nil {
+		return nil, err
+	}
+	for _, x := range t.OnSuccess {
+		link, err := mm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		mt.OnSuccess = append(mt.OnSuccess, link)
+	}
+	for _, x := range t.OnFailed {
+		link, err := mm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		mt.OnFailed = append(mt.OnFailed, link)
+	}
+	return mt, nil
+}
+
+func (mm MsgpackMarshaller) toTask(mt *msgpackTask) (*task.Task, error) {
+	if mt.Task == nil {
+		return nil, errors.Errorf("task missing")
+	}
+
+	t := mt.Task
+	t.Args = make([]interface{}, len(mt.Args))
+	for i, v := range mt.Args {
+		val, err := mm.decodeValue(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode argument %d of %s failed", i, t.Name)
+		}
+		t.Args[i] = val
+	}
+	for _, x := range mt.OnSuccess {
+		link, err := mm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnSuccess = append(t.OnSuccess, link)
+	}
+	for _, x := range mt.OnFailed {
+		link, err := mm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnFailed = append(t.OnFailed, link)
+	}
+	return t, nil
+}
+
+func (mm MsgpackMarshaller) encodeValues(vals []interface{}) ([]msgpackValue, error) {
+	out := make([]msgpackValue, len(vals))
+	for i, v := range vals {
+		if v = indirect(v); v == nil {
+			continue
+		}
+
+		raw, err := msgpack.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out[i].Value = raw
+		out[i].Type, _ = lookupName(reflect.TypeOf(v))
+	}
+	return out, nil
+}
+
+func (mm MsgpackMarshaller) decodeValue(v msgpackValue) (interface{}, error) {
+	if len(v.Value) == 0 {
+		return nil, nil
+	}
+
+	if t, ok := lookupType(v.Type); ok {
+		p := reflect.New(t)
+		if err := msgpack.Unmarshal(v.Value, p.Interface()); err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	}
+
+	var val interface{}
+	if err := msgpack.Unmarshal(v.Value, &val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
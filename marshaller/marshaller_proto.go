@@ -0,0 +1,407 @@
+package marshaller
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/marshaller/pb"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ProtoMarshaller encodes tasks and results with the messages defined in
+// pb/asq.proto, so they can be produced and consumed by other languages.
+// Scalars, []byte, time.Time and time.Duration are carried as typed well
+// known types, everything else as google.protobuf.Value, and proto.Message
+// arguments are packed as they are.
+type ProtoMarshaller struct{}
+
+func NewProtoMarshaller() *ProtoMarshaller {
+	return &ProtoMarshaller{}
+}
+
+func (pm ProtoMarshaller) ContentType() string {
+	return "application/x-protobuf"
+}
+
+func (pm ProtoMarshaller) EncodeTask(task *task.Task) (string, error) {
+	if task == nil {
+		return "", errors.Errorf("nil is not acceptable")
+	}
+
+	msg, err := pm.fromTask(task)
+	if err != nil {
+		return "", errors.Wrapf(err, "protobuf marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		return "", errors.Wrapf(err, "protobuf marshal for task %s, %s failed", task.Name, task.Id)
+	}
+	return string(buf), nil
+}
+
+func (pm ProtoMarshaller) DecodeTask(buf string) (*task.Task, error) {
+	var msg pb.Task
+	if err := proto.Unmarshal([]byte(buf), &msg); err != nil {
+		return nil, errors.Wrapf(err, "protobuf unmarshal for %d bytes failed", len(buf))
+	}
+
+	task, err := pm.toTask(&msg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "protobuf unmarshal for %d bytes failed", len(buf))
+	}
+	return task, nil
+}
+
+func (pm ProtoMarshaller) EncodeResult(rs []interface{}, e error) (string, error) {
+	var (
+		msg pb.Result
+		err error
+	)
+	if msg.Results, err = pm.encodeValues(rs); err != nil {
+		return "", errors.Wrapf(err, "protobuf marshal for result of %d values failed", len(rs))
+	}
+	if e != nil {
+		msg.Error = e.Error()
+		msg.ErrorDetail = pm.encodeError(result.NewError(e))
+	}
+
+	buf, err := proto.Marshal(&msg)
+	if err != nil {
+		return "", errors.Wrapf(err, "protobuf marshal for result of %d values failed", len(rs))
+	}
+	return string(buf), nil
+}
+
+func (pm ProtoMarshaller) DecodeResult(buf string, args ...interface{}) (bool, error) {
+	var msg pb.Result
+	if err := proto.Unmarshal([]byte(buf), &msg); err != nil {
+		return false, errors.Wrapf(err, "protobuf unmarshal for %d bytes failed", len(buf))
+	}
+
+	for i := 0; i < len(args) && i < len(msg.Results); i++ {
+		v, err := pm.decodeValue(msg.Results[i])
+		if err != nil {
+			return false, errors.Wrapf(err, "decode result %d failed", i)
+		}
+		if err := assign(args[i], v); err != nil {
+			return false, errors.Wrapf(err, "assign result %d failed", i)
+		}
+	}
+
+	if msg.ErrorDetail != nil {
+		return true, pm.decodeError(msg.ErrorDetail).Err()
+	}
+	if msg.Error != "" {
+		return true, fmt.Errorf("%s", msg.Error)
+	}
+	return true, nil
+}
+
+func (pm ProtoMarshaller) encodeError(e *result.Error) *pb.Error {
+	if e == nil {
+		return nil
+	}
+
+	msg := &pb.Error{
+		Message:   e.Message,
+		Code:      e.Code,
+		Type:      e.Type,
+		Retryable: e.Retryable,
+		Cause:     pm.encodeError(e.Cause),
+	}
+	if len(e.Details) > 0 {
+		// details 可能包含任意类型，先转成 json 兼容的值
+		if buf, err := json.Marshal(e.Details); err == nil {
+			var details map[string]interface{}
+			if json.Unmarshal(buf, &details) == nil {
+				msg.Details, _ = structpb.NewStruct(details)
+			}
+		}
+	}
+	return msg
+}
+
+func (pm ProtoMarshaller) decodeError(msg *pb.Error) *result.Error {
+	if msg == nil {
+		return nil
+	}
+
+	e := &result.Error{
+		Message:   msg.GetMessage(),
+		Code:      msg.GetCode(),
+		Type:      msg.GetType(),
+		Retryable: msg.GetRetryable(),
+		Cause:     pm.decodeError(msg.GetCause()),
+	}
+	if msg.GetDetails() != nil {
+		e.Details = msg.GetDetails().AsMap()
+	}
+	return e
+}
+
+func (pm ProtoMarshaller) fromTask(t *task.Task) (*pb.Task, error) {
+	var err error
+
+	msg := &pb.Task{
+		Id:          t.Id,
+		Name:        t.Name,
+		Headers:     t.Headers,
+		SubmittedAt: t.SubmittedAt,
+		Option: &pb.TaskOption{
+			RetryCount:    int64(t.Option.RetryCount),
+			RetryTimeout:  int64(t.Option.RetryTimeout),
+			ResultExpired: int64(t.Option.ResultExpired),
+			IgnoreResult:  t.Option.IgnoreResult,
+			StartAt:       t.Option.StartAt,
+			Retry:         pm.fromRetry(t.Option.Retry),
+		},
+	}
+	if t.BackOff != nil {
+		msg.BackOff = &pb.BackOff{
+			Attempts:     int64(t.BackOff.Attempts),
+			Factor:       t.BackOff.Factor,
+			Delay:        int64(t.BackOff.Delay),
+			Prev:         int64(t.BackOff.Prev),
+			FirstFailure: t.BackOff.FirstFailure,
+		}
+	}
+	if msg.Args, err = pm.encodeValues(t.Args); err != nil {
+		return nil, err
+	}
+	for _, x := range t.OnSuccess {
+		link, err := pm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		msg.OnSuccess = append(msg.OnSuccess, link)
+	}
+	for _, x := range t.OnFailed {
+		link, err := pm.fromTask(x)
+		if err != nil {
+			return nil, err
+		}
+		msg.OnFailed = append(msg.OnFailed, link)
+	}
+	return msg, nil
+}
+
+func (pm ProtoMarshaller) toTask(msg *pb.Task) (*task.Task, error) {
+	t := &task.Task{
+		Id:          msg.GetId(),
+		Name:        msg.GetName(),
+		Headers:     msg.GetHeaders(),
+		SubmittedAt: msg.GetSubmittedAt(),
+		Option: task.TaskOption{
+			RetryCount:    int(msg.GetOption().GetRetryCount()),
+			RetryTimeout:  int(msg.GetOption().GetRetryTimeout()),
+			ResultExpired: int(msg.GetOption().GetResultExpired()),
+			IgnoreResult:  msg.GetOption().GetIgnoreResult(),
+			Retry:         pm.toRetry(msg.GetOption().GetRetry()),
+		},
+		Args: make([]interface{}, len(msg.Args)),
+	}
+	if msg.GetOption() != nil && msg.GetOption().StartAt != nil {
+		t.Option.StartAt = new(int64)
+		*t.Option.StartAt = msg.GetOption().GetStartAt()
+	}
+	if bo := msg.GetBackOff(); bo != nil {
+		t.BackOff = &task.BackOff{
+			Attempts:     int(bo.Attempts),
+			Factor:       bo.Factor,
+			Delay:        time.Duration(bo.Delay),
+			Prev:         time.Duration(bo.Prev),
+			FirstFailure: bo.FirstFailure,
+		}
+	}
+	for i, a := range msg.Args {
+		v, err := pm.decodeValue(a)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode argument %d of %s failed", i, t.Name)
+		}
+		t.Args[i] = v
+	}
+	for _, x := range msg.OnSuccess {
+		link, err := pm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnSuccess = append(t.OnSuccess, link)
+	}
+	for _, x := range msg.OnFailed {
+		link, err := pm.toTask(x)
+		if err != nil {
+			return nil, err
+		}
+		t.OnFailed = append(t.OnFailed, link)
+	}
+	return t, nil
+}
+
+func (pm ProtoMarshaller) fromRetry(p *task.RetryPolicy) *pb.RetryPolicy {
+	if p == nil {
+		return nil
+	}
+
+	msg := &pb.RetryPolicy{
+		Kind:       p.Kind,
+		Delay:      int64(p.Delay),
+		Factor:     p.Factor,
+		Jitter:     p.Jitter,
+		MaxDelay:   int64(p.MaxDelay),
+		MaxElapsed: int64(p.MaxElapsed),
+	}
+	for k, v := range p.Overrides {
+		if msg.Overrides == nil {
+			msg.Overrides = make(map[string]*pb.RetryPolicy)
+		}
+		msg.Overrides[k] = pm.fromRetry(v)
+	}
+	return msg
+}
+
+func (pm ProtoMarshaller) toRetry(msg *pb.RetryPolicy) *task.RetryPolicy {
+	if msg == nil {
+		return nil
+	}
+
+	p := &task.RetryPolicy{
+		Kind:       msg.Kind,
+		Delay:      time.Duration(msg.Delay),
+		Factor:     msg.Factor,
+		Jitter:     msg.Jitter,
+		MaxDelay:   time.Duration(msg.MaxDelay),
+		MaxElapsed: time.Duration(msg.MaxElapsed),
+	}
+	for k, v := range msg.Overrides {
+		if p.Overrides == nil {
+			p.Overrides = make(map[string]*task.RetryPolicy)
+		}
+		p.Overrides[k] = pm.toRetry(v)
+	}
+	return p
+}
+
+func (pm ProtoMarshaller) encodeValues(vals []interface{}) ([]*anypb.Any, error) {
+	out := make([]*anypb.Any, len(vals))
+	for i, v := range vals {
+		a, err := pm.encodeValue(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode value %d failed", i)
+		}
+		out[i] = a
+	}
+	return out, nil
+}
+
+func (pm ProtoMarshaller) encodeValue(v interface{}) (*anypb.Any, error) {
+	var m proto.Message
+
+	switch x := v.(type) {
+	case proto.Message:
+		m = x
+	case time.Time:
+		m = timestamppb.New(x)
+	case time.Duration:
+		m = durationpb.New(x)
+	case []byte:
+		m = wrapperspb.Bytes(x)
+	default:
+		switch x := indirect(v).(type) {
+		case nil:
+			m = structpb.NewNullValue()
+		case bool:
+			m = wrapperspb.Bool(x)
+		case int:
+			m = wrapperspb.Int64(int64(x))
+		case int8:
+			m = wrapperspb.Int32(int32(x))
+		case int16:
+			m = wrapperspb.Int32(int32(x))
+		case int32:
+			m = wrapperspb.Int32(x)
+		case int64:
+			m = wrapperspb.Int64(x)
+		case uint:
+			m = wrapperspb.UInt64(uint64(x))
+		case uint8:
+			m = wrapperspb.UInt32(uint32(x))
+		case uint16:
+			m = wrapperspb.UInt32(uint32(x))
+		case uint32:
+			m = wrapperspb.UInt32(x)
+		case uint64:
+			m = wrapperspb.UInt64(x)
+		case float32:
+			m = wrapperspb.Float(x)
+		case float64:
+			m = wrapperspb.Double(x)
+		case string:
+			m = wrapperspb.String(x)
+		case time.Time, time.Duration, []byte:
+			return pm.encodeValue(x)
+		default:
+			// 结构体等复杂类型通过 json 转成 google.protobuf.Value
+			buf, err := json.Marshal(x)
+			if err != nil {
+				return nil, err
+			}
+			var val interface{}
+			if err := json.Unmarshal(buf, &val); err != nil {
+				return nil, err
+			}
+			if m, err = structpb.NewValue(val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return anypb.New(m)
+}
+
+func (pm ProtoMarshaller) decodeValue(a *anypb.Any) (interface{}, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	m, err := a.UnmarshalNew()
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := m.(type) {
+	case *wrapperspb.BoolValue:
+		return x.Value, nil
+	case *wrapperspb.Int32Value:
+		return x.Value, nil
+	case *wrapperspb.Int64Value:
+		return x.Value, nil
+	case *wrapperspb.UInt32Value:
+		return x.Value, nil
+	case *wrapperspb.UInt64Value:
+		return x.Value, nil
+	case *wrapperspb.FloatValue:
+		return x.Value, nil
+	case *wrapperspb.DoubleValue:
+		return x.Value, nil
+	case *wrapperspb.StringValue:
+		return x.Value, nil
+	case *wrapperspb.BytesValue:
+		return x.Value, nil
+	case *timestamppb.Timestamp:
+		return x.AsTime(), nil
+	case *durationpb.Duration:
+		return x.AsDuration(), nil
+	case *structpb.Value:
+		return x.AsInterface(), nil
+	}
+	return m, nil
+}
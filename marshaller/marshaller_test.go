@@ -0,0 +1,434 @@
+package marshaller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/invoker"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+type testPoint struct {
+	X int64
+	Y string
+}
+
+func init() {
+	RegisterType(testPoint{})
+}
+
+func testMove(p *testPoint, d time.Duration, ts time.Time, b []byte) (*testPoint, error) {
+	return &testPoint{X: p.X + int64(d), Y: p.Y + string(b) + ts.Format("2006")}, nil
+}
+
+func testRetryPolicy() *task.RetryPolicy {
+	return task.NewExponentialRetry(time.Second, 3).
+		WithJitter(0.2).
+		WithMaxDelay(time.Minute).
+		WithOverride("timeout", task.NewFixedRetry(time.Second))
+}
+
+func typedMarshallers() map[string]Marshaller {
+	return map[string]Marshaller{
+		"gob":     NewGobMarshaller(),
+		"msgpack": NewMsgpackMarshaller(),
+		"json":    NewJsonSafeMarshaller(),
+	}
+}
+
+func TestTypedTask(t *testing.T) {
+	is := is.New(t)
+
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	for name, m := range typedMarshallers() {
+		t1 := task.NewTask(task.NewTaskOption(3, time.Second).WithRetryPolicy(testRetryPolicy()),
+			"move", &testPoint{X: 1 << 60, Y: "y"}, time.Second, ts, []byte("b"))
+		t1.OnSuccess = []*task.Task{task.NewTask(nil, "next", nil)}
+
+		buf, err := m.EncodeTask(t1)
+		is.NoErr(err)
+		t2, err := m.DecodeTask(buf)
+		is.NoErr(err)
+
+		is.Equal(t2.Id, t1.Id)
+		is.Equal(t2.Option, t1.Option)
+		is.Equal(t2.Args[0], testPoint{X: 1 << 60, Y: "y"})
+		is.Equal(t2.Args[1], time.Second)
+		is.True(t2.Args[2].(time.Time).Equal(ts))
+		is.Equal(t2.Args[3], []byte("b"))
+		is.Equal(len(t2.OnSuccess), 1)
+		is.Equal(t2.OnSuccess[0].Name, "next")
+		is.Nil(t2.OnSuccess[0].Args[0])
+
+		// 类型保留以后 lazyInvoker 可以直接调用
+		rs, err := invoker.NewLazyInvoker().Invoke(testMove, t2.Args)
+		is.NoErr(err)
+		is.Equal(rs[0].(*testPoint).X, int64(1<<60+int64(time.Second)))
+		t.Logf("%s: task %d bytes", name, len(buf))
+	}
+}
+
+func TestTypedResult(t *testing.T) {
+	is := is.New(t)
+
+	for _, m := range typedMarshallers() {
+		buf, err := m.EncodeResult([]interface{}{&testPoint{X: 3}, uint64(1 << 63), (*testPoint)(nil)}, nil)
+		is.NoErr(err)
+
+		var (
+			p *testPoint
+			u uint64
+			n *testPoint
+		)
+		ok, err := m.DecodeResult(buf, &p, &u, &n)
+		is.True(ok)
+		is.NoErr(err)
+		is.Equal(p.X, int64(3))
+		is.Equal(u, uint64(1<<63))
+		is.Nil(n)
+
+		buf, err = m.EncodeResult(nil, errors.New("failed"))
+		is.NoErr(err)
+		ok, err = m.DecodeResult(buf)
+		is.True(ok)
+		is.Equal(err.Error(), "failed")
+	}
+}
+
+func TestProtoMarshaller(t *testing.T) {
+	is := is.New(t)
+
+	m := NewProtoMarshaller()
+	ts := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	t1 := task.NewTask(task.NewTaskOption(3, time.Second).WithStartAt(ts).WithRetryPolicy(testRetryPolicy()),
+		"move", &testPoint{X: 1 << 60, Y: "y"}, int64(1<<60), time.Second, ts, []byte("b"), nil)
+	t1.OnSuccess = []*task.Task{task.NewTask(nil, "next")}
+
+	buf, err := m.EncodeTask(t1)
+	is.NoErr(err)
+	t2, err := m.DecodeTask(buf)
+	is.NoErr(err)
+
+	is.Equal(t2.Id, t1.Id)
+	is.Equal(t2.Option, t1.Option)
+	is.Equal(*t2.BackOff, *t1.BackOff)
+	// 结构体通过 google.protobuf.Value 传递，数字会变成 float64
+	is.Equal(t2.Args[0], map[string]interface{}{"X": float64(1 << 60), "Y": "y"})
+	is.Equal(t2.Args[1], int64(1<<60))
+	is.Equal(t2.Args[2], time.Second)
+	is.True(t2.Args[3].(time.Time).Equal(ts))
+	is.Equal(t2.Args[4], []byte("b"))
+	is.Nil(t2.Args[5])
+	is.Equal(t2.OnSuccess[0].Name, "next")
+
+	buf, err = m.EncodeResult([]interface{}{&testPoint{X: 3, Y: "y"}, uint64(1 << 63)}, errors.New("failed"))
+	is.NoErr(err)
+	var (
+		p testPoint
+		u uint64
+	)
+	ok, err := m.DecodeResult(buf, &p, &u)
+	is.True(ok)
+	is.Equal(err.Error(), "failed")
+	is.Equal(p, testPoint{X: 3, Y: "y"})
+	is.Equal(u, uint64(1<<63))
+}
+
+func TestJsonSafeNumber(t *testing.T) {
+	is := is.New(t)
+
+	m := NewJsonSafeMarshaller()
+	buf, err := m.EncodeTask(task.NewTask(nil, "ids",
+		map[string]interface{}{"id": int64(1<<53 + 1)}, uint64(1<<64-1)))
+	is.NoErr(err)
+	t2, err := m.DecodeTask(buf)
+	is.NoErr(err)
+
+	var (
+		id struct {
+			ID int64 `json:"id"`
+		}
+		u uint64
+	)
+	is.NoErr(invoker.Decode(t2.Args[0], &id))
+	is.Equal(id.ID, int64(1<<53+1))
+	is.NoErr(invoker.Decode(t2.Args[1], &u))
+	is.Equal(u, uint64(1<<64-1))
+
+	buf, err = m.EncodeResult([]interface{}{int64(1<<53 + 1), []byte("x")}, nil)
+	is.NoErr(err)
+	var (
+		i interface{}
+		b []byte
+	)
+	ok, err := m.DecodeResult(buf, &i, &b)
+	is.True(ok)
+	is.NoErr(err)
+	is.Equal(i, int64(1<<53+1))
+	is.Equal(b, []byte("x"))
+}
+
+var errTestNotFound = errors.New("not found")
+
+type testCodeError struct {
+	Field  string
+	Reason string
+}
+
+func (e *testCodeError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+func (e *testCodeError) Retryable() bool {
+	return false
+}
+
+func init() {
+	result.RegisterError(errTestNotFound)
+	result.RegisterErrorType(&testCodeError{})
+}
+
+func TestStructuredError(t *testing.T) {
+	is := is.New(t)
+
+	all := typedMarshallers()
+	all["plain"] = NewJsonMarshaller()
+	all["proto"] = NewProtoMarshaller()
+	for name, m := range all {
+		buf, err := m.EncodeResult(nil, fmt.Errorf("load order: %w", errTestNotFound))
+		is.NoErr(err)
+		ok, err := m.DecodeResult(buf)
+		is.True(ok)
+		is.True(errors.Is(err, errTestNotFound))
+		is.Equal(err.Error(), "load order: not found")
+
+		buf, err = m.EncodeResult(nil, fmt.Errorf("validate: %w", &testCodeError{Field: "name", Reason: "empty"}))
+		is.NoErr(err)
+		_, err = m.DecodeResult(buf)
+		var ce *testCodeError
+		is.True(errors.As(err, &ce))
+		is.Equal(*ce, testCodeError{Field: "name", Reason: "empty"})
+
+		var re *result.Error
+		is.True(errors.As(err, &re))
+		is.False(re.Retryable)
+		is.Equal(re.Type, "*fmt.wrapError")
+		t.Logf("%s: %d bytes", name, len(buf))
+	}
+}
+
+func TestLegacyJsonError(t *testing.T) {
+	is := is.New(t)
+
+	var i int
+	ok, err := NewJsonMarshaller().DecodeResult(`[1, "failed"]`, &i)
+	is.True(ok)
+	is.Equal(i, 1)
+	is.Equal(err.Error(), "failed")
+
+	ok, err = NewJsonMarshaller().DecodeResult(`[2, ""]`, &i)
+	is.True(ok)
+	is.NoErr(err)
+	is.Equal(i, 2)
+
+	// 旧版本按字符串读取错误
+	buf, err := NewJsonMarshaller().EncodeResult([]interface{}{3}, fmt.Errorf("load order: %w", errTestNotFound))
+	is.NoErr(err)
+	var msg string
+	is.NoErr(json.Unmarshal([]byte(buf), &[]interface{}{&i, &msg}))
+	is.Equal(i, 3)
+	is.Equal(msg, "load order: not found")
+}
+
+func TestCompressMarshaller(t *testing.T) {
+	is := is.New(t)
+
+	gz, err := NewCompressMarshaller(NewJsonMarshaller(), CompressGzip, 256)
+	is.NoErr(err)
+	zs, err := NewCompressMarshaller(NewJsonMarshaller(), CompressZstd, 256)
+	is.NoErr(err)
+	_, err = NewCompressMarshaller(NewJsonMarshaller(), "lz4", 256)
+	is.Err(err)
+
+	small := task.NewTask(nil, "small", "x")
+	large := task.NewTask(nil, "large", strings.Repeat("document ", 1000))
+
+	buf, err := gz.EncodeTask(small)
+	is.NoErr(err)
+	is.True(strings.HasPrefix(buf, "{"))
+
+	for _, m := range []*CompressMarshaller{gz, zs} {
+		buf, err = m.EncodeTask(large)
+		is.NoErr(err)
+		is.True(len(buf) < 1000)
+
+		// 旧的未压缩的数据和其他压缩算法的数据都可以解码
+		for _, d := range []Marshaller{gz, zs} {
+			t2, err := d.DecodeTask(buf)
+			is.NoErr(err)
+			is.Equal(t2.Args[0], large.Args[0])
+		}
+	}
+
+	plain, err := NewJsonMarshaller().EncodeTask(large)
+	is.NoErr(err)
+	t2, err := zs.DecodeTask(plain)
+	is.NoErr(err)
+	is.Equal(t2.Id, large.Id)
+
+	buf, err = zs.EncodeResult([]interface{}{strings.Repeat("r", 1000)}, nil)
+	is.NoErr(err)
+	var r string
+	ok, err := gz.DecodeResult(buf, &r)
+	is.True(ok)
+	is.NoErr(err)
+	is.Equal(len(r), 1000)
+	is.Nil(gz.zenc)
+
+	// 解压后超过上限的数据不解码
+	for _, m := range []*CompressMarshaller{gz, zs} {
+		buf, err = m.EncodeTask(large)
+		is.NoErr(err)
+		small, err := NewCompressMarshaller(NewJsonMarshaller(), CompressGzip, 256)
+		is.NoErr(err)
+		_, err = small.WithMaxDecompressed(4096).DecodeTask(buf)
+		is.Err(err)
+		is.NoErr(m.Close())
+	}
+}
+
+func TestEncryptMarshaller(t *testing.T) {
+	is := is.New(t)
+
+	k1, k2 := []byte(strings.Repeat("1", 32)), []byte(strings.Repeat("2", 16))
+	_, err := NewEncryptMarshaller(NewJsonMarshaller(), "k3", map[string][]byte{"k1": k1})
+	is.Err(err)
+	_, err = NewEncryptMarshaller(NewJsonMarshaller(), "k1", map[string][]byte{"k1": []byte("short")})
+	is.Err(err)
+
+	old, err := NewEncryptMarshaller(NewJsonMarshaller(), "k1", map[string][]byte{"k1": k1})
+	is.NoErr(err)
+	cur, err := NewEncryptMarshaller(NewJsonMarshaller(), "k2", map[string][]byte{"k1": k1, "k2": k2})
+	is.NoErr(err)
+
+	t1 := task.NewTask(nil, "login", "user", "password")
+	buf, err := old.EncodeTask(t1)
+	is.NoErr(err)
+	is.False(strings.Contains(buf, "password"))
+
+	// 新的 key 加密，旧的 key 仍然可以解密
+	t2, err := cur.DecodeTask(buf)
+	is.NoErr(err)
+	is.Equal(t2.Args, t1.Args)
+
+	buf, err = cur.EncodeResult([]interface{}{"token"}, nil)
+	is.NoErr(err)
+	_, err = old.DecodeResult(buf)
+	is.Err(err)
+	var token string
+	ok, err := cur.DecodeResult(buf, &token)
+	is.True(ok)
+	is.NoErr(err)
+	is.Equal(token, "token")
+
+	// 篡改的数据无法解密
+	b := []byte(buf)
+	b[len(b)-1] ^= 1
+	_, err = cur.DecodeResult(string(b))
+	is.Err(err)
+
+	plain, err := NewJsonMarshaller().EncodeTask(t1)
+	is.NoErr(err)
+	_, err = cur.DecodeTask(plain)
+	is.Err(err)
+	_, err = cur.AcceptPlaintext(true).DecodeTask(plain)
+	is.NoErr(err)
+}
+
+func TestEnvelopeMarshaller(t *testing.T) {
+	is := is.New(t)
+
+	_, err := NewEnvelopeMarshaller(&CompressMarshaller{})
+	is.Err(err)
+
+	em, err := NewEnvelopeMarshaller(NewJsonMarshaller())
+	is.NoErr(err)
+
+	t1 := task.NewTask(nil, "add", 1, 2)
+	buf, err := em.EncodeTask(t1)
+	is.NoErr(err)
+	is.True(strings.HasPrefix(buf, envelopeMagic+"\x01"+"\x10application/json{"))
+	t2, err := em.DecodeTask(buf)
+	is.NoErr(err)
+	is.Equal(t2.Name, "add")
+
+	// 没有信封的旧数据
+	legacy, err := NewJsonMarshaller().EncodeTask(t1)
+	is.NoErr(err)
+	t2, err = em.DecodeTask(legacy)
+	is.NoErr(err)
+	is.Equal(t2.Name, "add")
+
+	// 切换 marshaller，旧的数据仍然可以解码
+	mm, err := NewEnvelopeMarshaller(NewMsgpackMarshaller(), NewJsonMarshaller())
+	is.NoErr(err)
+	t2, err = mm.DecodeTask(buf)
+	is.NoErr(err)
+	is.Equal(t2.Name, "add")
+	rs, err := mm.EncodeResult([]interface{}{3}, nil)
+	is.NoErr(err)
+	var sum int
+	ok, err := mm.DecodeResult(rs, &sum)
+	is.True(ok)
+	is.NoErr(err)
+	is.Equal(sum, 3)
+	_, err = em.DecodeResult(rs, &sum)
+	is.Err(err)
+
+	newer := envelopeMagic + "\x02" + buf[len(envelopeMagic)+1:]
+	_, err = em.DecodeTask(newer)
+	is.Err(err)
+	_, err = em.DecodeTask(envelopeMagic + "\x01\x10app")
+	is.Err(err)
+
+	em.WithUpgrade(0, func(env *Envelope) error {
+		is.Equal(env.ContentType, "application/json")
+		is.False(env.Result)
+		env.Payload = strings.Replace(env.Payload, `"Name":"add"`, `"Name":"math.add"`, 1)
+		return nil
+	})
+	t2, err = em.DecodeTask(legacy)
+	is.NoErr(err)
+	is.Equal(t2.Name, "math.add")
+	t2, err = em.DecodeTask(buf)
+	is.NoErr(err)
+	is.Equal(t2.Name, "add")
+}
+
+func TestTaskHeaders(t *testing.T) {
+	is := is.New(t)
+
+	ms := typedMarshallers()
+	ms["legacy"] = NewJsonMarshaller()
+	ms["proto"] = NewProtoMarshaller()
+	for name, m := range ms {
+		t1 := task.NewTask(nil, "a").SetHeader("request-id", "r1")
+		t1.SubmittedAt = 1656806400000
+		t1.OnSuccess = []*task.Task{task.NewTask(nil, "b").SetHeader("tenant", "t1")}
+
+		buf, err := m.EncodeTask(t1)
+		is.NoErr(err)
+		t2, err := m.DecodeTask(buf)
+		is.NoErr(err)
+		is.Equal(t2.Headers, map[string]string{"request-id": "r1"})
+		is.Equal(t2.SubmittedAt, t1.SubmittedAt)
+		is.Equal(t2.OnSuccess[0].Headers, map[string]string{"tenant": "t1"})
+		t.Logf("%s: %d bytes", name, len(buf))
+	}
+}
@@ -0,0 +1,4 @@
+// Package pb contains the protobuf messages used by the protobuf marshaller.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative asq.proto
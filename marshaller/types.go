@@ -0,0 +1,116 @@
+package marshaller
+
+import (
+	"encoding/gob"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/zigzed/asq/invoker"
+)
+
+// 参数类型的注册表，gob/msgpack 编码时记录类型名，解码时据此恢复具体类型
+var registry = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+func init() {
+	for _, v := range []interface{}{
+		false,
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		"",
+		[]byte(nil),
+		[]string(nil),
+		[]int(nil),
+		[]int64(nil),
+		[]float64(nil),
+		[]interface{}(nil),
+		map[string]interface{}(nil),
+		time.Time{},
+		time.Duration(0),
+	} {
+		RegisterType(v)
+	}
+}
+
+// RegisterType records the concrete type of v, so that the gob and msgpack
+// marshallers can restore arguments and results of that type. Pointers are
+// registered by the type they point to.
+func RegisterType(v interface{}) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	name := typeName(t)
+	registry.byName[name] = t
+	registry.byType[t] = name
+	gob.Register(reflect.Zero(t).Interface())
+}
+
+func typeName(t reflect.Type) string {
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
+
+func lookupName(t reflect.Type) (string, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	name, ok := registry.byType[t]
+	return name, ok
+}
+
+func lookupType(name string) (reflect.Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	t, ok := registry.byName[name]
+	return t, ok
+}
+
+// indirect dereferences pointers, gob and msgpack can't keep the pointer
+// levels anyway and the lazy invoker restores them on invocation.
+func indirect(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+// assign stores the decoded val into the pointer dst.
+func assign(dst interface{}, val interface{}) error {
+	p := reflect.ValueOf(dst)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		return nil
+	}
+	if val == nil {
+		p.Elem().Set(reflect.Zero(p.Elem().Type()))
+		return nil
+	}
+
+	if v := reflect.ValueOf(val); v.Type().AssignableTo(p.Elem().Type()) {
+		p.Elem().Set(v)
+		return nil
+	}
+	return invoker.Decode(val, dst)
+}
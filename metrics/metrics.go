@@ -0,0 +1,157 @@
+// Package metrics exposes Prometheus collectors for asq tasks and queues.
+//
+//	c := metrics.NewCollector("asq")
+//	prometheus.MustRegister(c)
+//	app := asq.NewApp(broker, backend, asq.WithListeners(c.Observe))
+//	c.WatchQueue("queue", broker)
+package metrics
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/zigzed/asq"
+)
+
+// Queue is implemented by brokers reporting their lengths, like the redis
+// broker.
+type Queue interface {
+	Len(ctx context.Context) (int64, error)
+	DelayedLen(ctx context.Context) (int64, error)
+}
+
+// 采集队列长度的超时时间
+const scrapeTimeout = 5 * time.Second
+
+// Collector counts the task events reported by asq.WithListeners and the
+// lengths of the watched queues.
+type Collector struct {
+	events   map[asq.EventKind]*prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	wait     *prometheus.HistogramVec
+	inflight *prometheus.GaugeVec
+
+	queueLen   *prometheus.Desc
+	delayedLen *prometheus.Desc
+	scrapeErr  *prometheus.Desc
+
+	mu     sync.RWMutex
+	queues map[string]Queue
+}
+
+func NewCollector(namespace string) *Collector {
+	counter := func(name, help string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      name,
+			Help:      help,
+		}, []string{"task"})
+	}
+
+	return &Collector{
+		events: map[asq.EventKind]*prometheus.CounterVec{
+			asq.EventSubmitted:    counter("tasks_submitted_total", "Tasks pushed to the broker."),
+			asq.EventStarted:      counter("tasks_started_total", "Tasks started by workers."),
+			asq.EventSucceeded:    counter("tasks_succeeded_total", "Tasks executed without error."),
+			asq.EventFailed:       counter("tasks_failed_total", "Task attempts returning an error."),
+			asq.EventRetried:      counter("tasks_retried_total", "Tasks scheduled for another attempt."),
+			asq.EventDeadLettered: counter("tasks_dead_lettered_total", "Tasks given up after all attempts."),
+			asq.EventRevoked:      counter("tasks_revoked_total", "Revoked tasks dropped by workers."),
+			asq.EventGivenUp:      counter("tasks_given_up_total", "Tasks failed for the last time without a dead letter queue."),
+		},
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "task_duration_seconds",
+			Help:      "Execution time of tasks.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"task"}),
+		wait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "task_queue_wait_seconds",
+			Help:      "Time from submit, or due time of delayed tasks, to start.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, []string{"task"}),
+		inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "tasks_in_flight",
+			Help:      "Tasks being executed by the worker.",
+		}, []string{"worker"}),
+		queueLen: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_length"),
+			"Tasks waiting in the queue.", []string{"queue"}, nil),
+		delayedLen: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_delayed_length"),
+			"Tasks scheduled for later in the queue.", []string{"queue"}, nil),
+		scrapeErr: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "queue_scrape_error"),
+			"1 if the lengths of the queue could not be read.", []string{"queue"}, nil),
+		queues: make(map[string]Queue),
+	}
+}
+
+// Observe is the asq.Listener updating the metrics.
+func (c *Collector) Observe(e asq.Event) {
+	name := e.Task.Name
+	if counter, ok := c.events[e.Kind]; ok {
+		counter.WithLabelValues(name).Inc()
+	}
+
+	switch e.Kind {
+	case asq.EventStarted:
+		c.inflight.WithLabelValues(e.Worker).Inc()
+		if e.Task.SubmittedAt != 0 {
+			c.wait.WithLabelValues(name).Observe(e.Wait.Seconds())
+		}
+	case asq.EventSucceeded, asq.EventFailed:
+		c.inflight.WithLabelValues(e.Worker).Dec()
+		c.duration.WithLabelValues(name).Observe(e.Duration.Seconds())
+	}
+}
+
+// WatchQueue reports the lengths of q under the name when scraped.
+func (c *Collector) WatchQueue(name string, q Queue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queues[name] = q
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, counter := range c.events {
+		counter.Describe(ch)
+	}
+	c.duration.Describe(ch)
+	c.wait.Describe(ch)
+	c.inflight.Describe(ch)
+	ch <- c.queueLen
+	ch <- c.delayedLen
+	ch <- c.scrapeErr
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, counter := range c.events {
+		counter.Collect(ch)
+	}
+	c.duration.Collect(ch)
+	c.wait.Collect(ch)
+	c.inflight.Collect(ch)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	for name, q := range c.queues {
+		failed := 0.0
+		if n, err := q.Len(ctx); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.queueLen, prometheus.GaugeValue, float64(n), name)
+		} else {
+			failed = 1
+		}
+		if n, err := q.DelayedLen(ctx); err == nil {
+			ch <- prometheus.MustNewConstMetric(c.delayedLen, prometheus.GaugeValue, float64(n), name)
+		} else {
+			failed = 1
+		}
+		ch <- prometheus.MustNewConstMetric(c.scrapeErr, prometheus.GaugeValue, failed, name)
+	}
+}
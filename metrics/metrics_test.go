@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/zigzed/asq"
+	"github.com/zigzed/asq/task"
+)
+
+type fakeQueue struct {
+	n, delayed int64
+	err        error
+}
+
+func (q fakeQueue) Len(ctx context.Context) (int64, error) {
+	return q.n, q.err
+}
+
+func (q fakeQueue) DelayedLen(ctx context.Context) (int64, error) {
+	return q.delayed, q.err
+}
+
+func TestCollector(t *testing.T) {
+	is := is.New(t)
+
+	c := NewCollector("asq")
+	reg := prometheus.NewRegistry()
+	is.NoErr(reg.Register(c))
+
+	t1 := task.NewTask(nil, "add", 1, 2)
+	t1.SubmittedAt = time.Now().Add(-time.Second).UnixMilli()
+	c.Observe(asq.Event{Kind: asq.EventSubmitted, Task: t1})
+	c.Observe(asq.Event{Kind: asq.EventStarted, Task: t1, Worker: "w1", Wait: time.Second})
+	is.Equal(testutil.ToFloat64(c.inflight.WithLabelValues("w1")), 1.0)
+	c.Observe(asq.Event{Kind: asq.EventFailed, Task: t1, Worker: "w1", Duration: time.Millisecond})
+	c.Observe(asq.Event{Kind: asq.EventRetried, Task: t1, Worker: "w1"})
+	c.Observe(asq.Event{Kind: asq.EventStarted, Task: t1, Worker: "w1"})
+	c.Observe(asq.Event{Kind: asq.EventSucceeded, Task: t1, Worker: "w1", Duration: time.Millisecond})
+
+	is.Equal(testutil.ToFloat64(c.events[asq.EventSubmitted]), 1.0)
+	is.Equal(testutil.ToFloat64(c.events[asq.EventStarted]), 2.0)
+	is.Equal(testutil.ToFloat64(c.events[asq.EventFailed]), 1.0)
+	is.Equal(testutil.ToFloat64(c.events[asq.EventRetried]), 1.0)
+	is.Equal(testutil.ToFloat64(c.events[asq.EventSucceeded]), 1.0)
+	is.Equal(testutil.ToFloat64(c.inflight.WithLabelValues("w1")), 0.0)
+
+	c.WatchQueue("default", fakeQueue{n: 3, delayed: 2})
+	c.WatchQueue("broken", fakeQueue{err: errors.New("down")})
+	is.NoErr(testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP asq_queue_length Tasks waiting in the queue.
+# TYPE asq_queue_length gauge
+asq_queue_length{queue="default"} 3
+# HELP asq_queue_delayed_length Tasks scheduled for later in the queue.
+# TYPE asq_queue_delayed_length gauge
+asq_queue_delayed_length{queue="default"} 2
+# HELP asq_queue_scrape_error 1 if the lengths of the queue could not be read.
+# TYPE asq_queue_scrape_error gauge
+asq_queue_scrape_error{queue="broken"} 1
+asq_queue_scrape_error{queue="default"} 0
+`), "asq_queue_length", "asq_queue_delayed_length", "asq_queue_scrape_error"))
+
+	n, err := testutil.GatherAndCount(reg, "asq_task_queue_wait_seconds", "asq_task_duration_seconds")
+	is.NoErr(err)
+	is.Equal(n, 2)
+}
@@ -1,23 +1,33 @@
 package asq
 
 import (
+	"reflect"
 	"sync"
 
 	"emperror.dev/errors"
 )
 
+type fnHandler struct {
+	fn      interface{}
+	invoker Invoker
+	// 每个 worker 每秒执行的次数，0 表示不限制
+	rate float64
+	// 函数的参数类型，解码出的参数没有 struct tag，按它们脱敏
+	params []reflect.Type
+}
+
 type fnManager struct {
 	sync.RWMutex
-	fn map[string]interface{}
+	fn map[string]*fnHandler
 }
 
 func newFnManager() *fnManager {
 	return &fnManager{
-		fn: make(map[string]interface{}, 0),
+		fn: make(map[string]*fnHandler, 0),
 	}
 }
 
-func (fm *fnManager) register(name string, fn interface{}) error {
+func (fm *fnManager) register(name string, h *fnHandler) error {
 	fm.Lock()
 	defer fm.Unlock()
 
@@ -25,11 +35,11 @@ func (fm *fnManager) register(name string, fn interface{}) error {
 		return errors.Errorf("function %s registered", name)
 	}
 
-	fm.fn[name] = fn
+	fm.fn[name] = h
 	return nil
 }
 
-func (fm *fnManager) lookup(name string) (interface{}, error) {
+func (fm *fnManager) lookup(name string) (*fnHandler, error) {
 	fm.RLock()
 	defer fm.RUnlock()
 
@@ -39,6 +49,18 @@ func (fm *fnManager) lookup(name string) (interface{}, error) {
 	return nil, errors.Errorf("function %s not registered", name)
 }
 
+// params returns the parameter types of the function name, nil if not
+// registered.
+func (fm *fnManager) params(name string) []reflect.Type {
+	fm.RLock()
+	defer fm.RUnlock()
+
+	if fn, ok := fm.fn[name]; ok {
+		return fn.params
+	}
+	return nil
+}
+
 func (fm *fnManager) registered() []string {
 	fm.RLock()
 	defer fm.RUnlock()
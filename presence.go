@@ -0,0 +1,128 @@
+package asq
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/zigzed/asq/registry"
+	"github.com/zigzed/asq/task"
+)
+
+const (
+	heartbeatPeriod = 5 * time.Second
+	// 连续丢失三次心跳才认为 worker 已经退出
+	heartbeatTTL = 3 * heartbeatPeriod
+)
+
+// ErrNoRegistry is returned by App.Workers if the app has no registry.
+var ErrNoRegistry = errors.New("no worker registry")
+
+// WithRegistry registers the workers of the app in r, they heartbeat their
+// description and running tasks until stopped. NewAppFromRedis uses the
+// redis registry if redis.Option.Registry is set.
+func WithRegistry(r registry.Registry) Options {
+	return func(app *App) {
+		app.registry = r
+	}
+}
+
+// Workers returns the workers in the registry, of all the apps sharing it.
+// Workers killed without unregistering are not Alive.
+func (app *App) Workers(ctx context.Context) ([]*registry.Worker, error) {
+	if app.registry == nil {
+		return nil, ErrNoRegistry
+	}
+	return app.registry.Workers(ctx)
+}
+
+// DeadWorkers returns the workers which stopped sending heartbeats, the
+// tasks they were running are lost unless retried by the producer.
+func (app *App) DeadWorkers(ctx context.Context) ([]*registry.Worker, error) {
+	workers, err := app.Workers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	dead := workers[:0]
+	for _, w := range workers {
+		if !w.Alive(now) {
+			dead = append(dead, w)
+		}
+	}
+	return dead, nil
+}
+
+// heartbeat keeps the worker registered until ctx is done.
+func (w *Worker) heartbeat(ctx context.Context) {
+	beat := func(ctx context.Context) {
+		if err := w.registry.Heartbeat(ctx, w.info()); err != nil {
+			w.logger.Warn("asq: heartbeat failed", "worker", w.id, "error", err)
+		}
+	}
+
+	beat(ctx)
+	tick := time.NewTicker(heartbeatPeriod)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), heartbeatPeriod)
+			defer cancel()
+			if err := w.registry.Unregister(ctx, w.id); err != nil {
+				w.logger.Warn("asq: unregister worker failed", "worker", w.id, "error", err)
+			}
+			return
+		case <-tick.C:
+			beat(ctx)
+		}
+	}
+}
+
+func (w *Worker) info() *registry.Worker {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	info := &registry.Worker{
+		Id:        w.id,
+		Hostname:  host,
+		Pid:       os.Getpid(),
+		Tasks:     w.fnMgr.registered(),
+		Heartbeat: time.Now(),
+		TTL:       heartbeatTTL,
+	}
+	if q, ok := w.broker.(interface{ Name() string }); ok {
+		info.Queues = []string{q.Name()}
+	}
+	sort.Strings(info.Tasks)
+
+	w.mu.Lock()
+	info.Concurrency, info.Started = w.concurrency, w.started
+	for _, t := range w.running {
+		c := *t
+		info.Running = append(info.Running, &c)
+	}
+	w.mu.Unlock()
+	sort.Slice(info.Running, func(i, j int) bool {
+		return info.Running[i].Started.Before(info.Running[j].Started)
+	})
+	return info
+}
+
+// track records the task being executed for the heartbeats.
+func (w *Worker) track(t *task.Task, start time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.running[t.Id] = &registry.Task{Id: t.Id, Name: t.Name, Started: start}
+}
+
+func (w *Worker) untrack(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.running, id)
+}
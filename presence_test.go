@@ -0,0 +1,108 @@
+package asq
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/registry"
+	"github.com/zigzed/asq/task"
+)
+
+type memRegistry struct {
+	sync.Mutex
+	workers map[string]*registry.Worker
+}
+
+func (mr *memRegistry) Heartbeat(ctx context.Context, w *registry.Worker) error {
+	mr.Lock()
+	defer mr.Unlock()
+
+	mr.workers[w.Id] = w
+	return nil
+}
+
+func (mr *memRegistry) Unregister(ctx context.Context, id string) error {
+	mr.Lock()
+	defer mr.Unlock()
+
+	delete(mr.workers, id)
+	return nil
+}
+
+func (mr *memRegistry) Workers(ctx context.Context) ([]*registry.Worker, error) {
+	mr.Lock()
+	defer mr.Unlock()
+
+	var workers []*registry.Worker
+	for _, w := range mr.workers {
+		workers = append(workers, w)
+	}
+	return workers, nil
+}
+
+func (mr *memRegistry) len() int {
+	mr.Lock()
+	defer mr.Unlock()
+
+	return len(mr.workers)
+}
+
+func TestWorkerPresence(t *testing.T) {
+	is := is.New(t)
+
+	reg := &memRegistry{workers: make(map[string]*registry.Worker)}
+	var (
+		w       *Worker
+		running []*registry.Task
+	)
+	w, _, _ = newMemWorker(t, "report", func() error {
+		running = w.info().Running
+		return nil
+	}, WithRegistry(reg))
+
+	t1 := task.NewTask(nil, "report")
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(running), 1)
+	is.Equal(running[0].Id, t1.Id)
+	is.Equal(len(w.info().Running), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.heartbeat(ctx)
+		close(done)
+	}()
+	for i := 0; i < 100 && reg.len() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	app := NewApp(&memBroker{}, &memBackend{}, WithRegistry(reg))
+	workers, err := app.Workers(context.Background())
+	is.NoErr(err)
+	is.Equal(len(workers), 1)
+	is.Equal(workers[0].Id, w.ID())
+	is.Equal(workers[0].Tasks, []string{"report"})
+	is.True(workers[0].Alive(time.Now()))
+
+	reg.Heartbeat(context.Background(), &registry.Worker{
+		Id:        "gone",
+		Heartbeat: time.Now().Add(-time.Minute),
+		TTL:       heartbeatTTL,
+	})
+	dead, err := app.DeadWorkers(context.Background())
+	is.NoErr(err)
+	is.Equal(len(dead), 1)
+	is.Equal(dead[0].Id, "gone")
+
+	// 停止后注销
+	cancel()
+	<-done
+	is.Equal(reg.len(), 1)
+
+	_, err = NewApp(&memBroker{}, &memBackend{}).Workers(context.Background())
+	is.True(errors.Is(err, ErrNoRegistry))
+}
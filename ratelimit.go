@@ -0,0 +1,90 @@
+package asq
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zigzed/asq/task"
+)
+
+const rateHeader = "asq-rate-at"
+
+// rateLimiter spaces the executions of a task by 1/rate seconds, without
+// burst. A zero rate does not limit.
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate float64
+	next time.Time
+}
+
+func (l *rateLimiter) setRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	// 新的速率从现在开始生效
+	l.next = time.Time{}
+}
+
+func (l *rateLimiter) limit() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// reserve takes the next execution slot and returns how long to wait for it.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate <= 0 {
+		return 0
+	}
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(time.Duration(float64(time.Second) / l.rate))
+	return at.Sub(now)
+}
+
+// throttle reschedules the task to its slot if the function is over its rate
+// limit, instead of holding the executor. The slot is kept in the
+// asq-rate-at header, so the task doesn't reserve another one when polled
+// again.
+func (w *Worker) throttle(ctx context.Context, task *task.Task, h *fnHandler) (bool, error) {
+	now := time.Now()
+	if at, ok := task.Headers[rateHeader]; ok {
+		ms, _ := strconv.ParseInt(at, 10, 64)
+		// 提前被拉取时继续等到预留的时间
+		if delay := time.UnixMilli(ms).Sub(now); delay > 0 {
+			return true, w.reschedule(ctx, task, delay)
+		}
+		delete(task.Headers, rateHeader)
+		return false, nil
+	}
+
+	delay := w.limiter(task.Name, h).reserve(now)
+	if delay <= 0 {
+		return false, nil
+	}
+	task.SetHeader(rateHeader, strconv.FormatInt(now.Add(delay).UnixMilli(), 10))
+	return true, w.reschedule(ctx, task, delay)
+}
+
+// limiter returns the rate limiter of the task on this worker, the initial
+// rate is the one given at register.
+func (w *Worker) limiter(name string, h *fnHandler) *rateLimiter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	l, ok := w.limits[name]
+	if !ok {
+		l = &rateLimiter{rate: h.rate}
+		w.limits[name] = l
+	}
+	return l
+}
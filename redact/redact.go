@@ -0,0 +1,330 @@
+// Package redact formats task args and results for logs and errors without
+// leaking secrets. Values are masked by position per task name, by the
+// `asq:"redact"` tag on struct fields, or by a hook:
+//
+//	redact.MaskArgs("login", 1) // login(user, password)
+//
+//	type Card struct {
+//		Holder string
+//		Number string `asq:"redact"`
+//	}
+package redact
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/zigzed/asq/task"
+)
+
+// Mask replaces the redacted values.
+const Mask = "***"
+
+// Hook may replace an arg or result of the task name before it is formatted,
+// e.g. with Mask. It returns v to keep the value.
+type Hook func(name string, v interface{}) interface{}
+
+var registry = struct {
+	sync.RWMutex
+	masks map[string]map[int]bool
+	hook  Hook
+}{
+	masks: make(map[string]map[int]bool),
+}
+
+// MaskArgs masks the args at indexes of the tasks called name.
+func MaskArgs(name string, indexes ...int) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.masks[name] == nil {
+		registry.masks[name] = make(map[int]bool)
+	}
+	for _, i := range indexes {
+		registry.masks[name][i] = true
+	}
+}
+
+// SetHook sets the hook applied to all args and results.
+func SetHook(h Hook) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	registry.hook = h
+}
+
+// Args formats the args of the task name.
+func Args(name string, args []interface{}) string {
+	return ArgsAs(name, args, nil)
+}
+
+// ArgsAs formats the args of the task name like Args, the decoded ones, like
+// the maps of JSON objects on the worker, are masked by the tags of their
+// types, i.e. the parameters of the function registered by the app.
+func ArgsAs(name string, args []interface{}, types []reflect.Type) string {
+	registry.RLock()
+	masks, hook := registry.masks[name], registry.hook
+	registry.RUnlock()
+
+	vals := make([]string, len(args))
+	for i, v := range args {
+		if masks[i] {
+			vals[i] = Mask
+			continue
+		}
+		if i < len(types) && types[i] != nil {
+			if hook != nil {
+				v = hook(name, v)
+			}
+			var sb strings.Builder
+			formatAs(&sb, reflect.ValueOf(v), types[i], 0)
+			vals[i] = sb.String()
+			continue
+		}
+		vals[i] = value(name, v, hook)
+	}
+	return "[" + strings.Join(vals, " ") + "]"
+}
+
+// Results formats the results of the task name, only the tags and the hook
+// apply to them.
+func Results(name string, results []interface{}) string {
+	registry.RLock()
+	hook := registry.hook
+	registry.RUnlock()
+
+	vals := make([]string, len(results))
+	for i, v := range results {
+		vals[i] = value(name, v, hook)
+	}
+	return "[" + strings.Join(vals, " ") + "]"
+}
+
+// Task formats the name, id and args of t.
+func Task(t *task.Task) string {
+	return TaskAs(t, nil)
+}
+
+// TaskAs formats the name, id and args of t, with the args formatted by
+// ArgsAs.
+func TaskAs(t *task.Task, types []reflect.Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%s(%s) %s", t.Name, t.Id, ArgsAs(t.Name, t.Args, types))
+}
+
+// Value formats v with the tagged struct fields masked.
+func Value(v interface{}) string {
+	var sb strings.Builder
+	format(&sb, reflect.ValueOf(v), 0)
+	return sb.String()
+}
+
+func value(name string, v interface{}, hook Hook) string {
+	if hook != nil {
+		v = hook(name, v)
+	}
+	return Value(v)
+}
+
+// 防止循环引用
+const maxDepth = 16
+
+func format(sb *strings.Builder, v reflect.Value, depth int) {
+	if !v.IsValid() {
+		sb.WriteString("<nil>")
+		return
+	}
+	if depth > maxDepth {
+		sb.WriteString("...")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			sb.WriteString("<nil>")
+			return
+		}
+		if v.Kind() == reflect.Ptr {
+			sb.WriteByte('&')
+		}
+		format(sb, v.Elem(), depth+1)
+	case reflect.Struct:
+		if !tagged(v.Type()) {
+			fmt.Fprintf(sb, "%+v", printable(v))
+			return
+		}
+		sb.WriteByte('{')
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(f.Name)
+			sb.WriteByte(':')
+			if redacted(f) {
+				sb.WriteString(Mask)
+			} else {
+				format(sb, v.Field(i), depth+1)
+			}
+		}
+		sb.WriteByte('}')
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			fmt.Fprintf(sb, "%v", printable(v))
+			return
+		}
+		sb.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			format(sb, v.Index(i), depth+1)
+		}
+		sb.WriteByte(']')
+	case reflect.Map:
+		sb.WriteString("map[")
+		for i, it := 0, v.MapRange(); it.Next(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			format(sb, it.Key(), depth+1)
+			sb.WriteByte(':')
+			format(sb, it.Value(), depth+1)
+		}
+		sb.WriteByte(']')
+	default:
+		fmt.Fprintf(sb, "%v", printable(v))
+	}
+}
+
+// formatAs formats the decoded v with the fields tagged in its type t masked,
+// e.g. the map[string]interface{} of a JSON object decoded for a struct.
+func formatAs(sb *strings.Builder, v reflect.Value, t reflect.Type, depth int) {
+	for v.IsValid() && v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if !v.IsValid() || depth > maxDepth || !tagged(t) || v.Type() == t {
+		format(sb, v, depth)
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		fields := fieldsByKey(t)
+		sb.WriteString("map[")
+		for i, key := range sortedKeys(v) {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(key.String())
+			sb.WriteByte(':')
+			if f, ok := fields[key.String()]; !ok {
+				format(sb, v.MapIndex(key), depth+1)
+			} else if redacted(f) {
+				sb.WriteString(Mask)
+			} else {
+				formatAs(sb, v.MapIndex(key), f.Type, depth+1)
+			}
+		}
+		sb.WriteByte(']')
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) &&
+		(v.Kind() == reflect.Slice || v.Kind() == reflect.Array):
+		sb.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			formatAs(sb, v.Index(i), t.Elem(), depth+1)
+		}
+		sb.WriteByte(']')
+	case t.Kind() == reflect.Map && v.Kind() == reflect.Map:
+		sb.WriteString("map[")
+		for i, it := 0, v.MapRange(); it.Next(); i++ {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			format(sb, it.Key(), depth+1)
+			sb.WriteByte(':')
+			formatAs(sb, it.Value(), t.Elem(), depth+1)
+		}
+		sb.WriteByte(']')
+	default:
+		format(sb, v, depth)
+	}
+}
+
+// fieldsByKey maps the keys of the decoded objects to the fields of t, by the
+// json tag or the field name like the invoker.
+func fieldsByKey(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fields[f.Name] = f
+		if key := strings.Split(f.Tag.Get("json"), ",")[0]; key != "" && key != "-" {
+			fields[key] = f
+		}
+	}
+	return fields
+}
+
+func sortedKeys(v reflect.Value) []reflect.Value {
+	keys := v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	return keys
+}
+
+// printable returns the value for fmt, unexported fields can't be interfaced.
+func printable(v reflect.Value) interface{} {
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	return v
+}
+
+func redacted(f reflect.StructField) bool {
+	for _, opt := range strings.Split(f.Tag.Get("asq"), ",") {
+		if opt == "redact" {
+			return true
+		}
+	}
+	return false
+}
+
+var taggedTypes sync.Map // reflect.Type -> bool
+
+// tagged reports whether t has redacted fields, also in nested types.
+func tagged(t reflect.Type) bool {
+	if v, ok := taggedTypes.Load(t); ok {
+		return v.(bool)
+	}
+	// 先假设没有，避免递归类型死循环
+	taggedTypes.Store(t, false)
+	found := hasTags(t)
+	taggedTypes.Store(t, found)
+	return found
+}
+
+func hasTags(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return tagged(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if redacted(t.Field(i)) || tagged(t.Field(i).Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+)
+
+type card struct {
+	Holder string
+	Number string `asq:"redact"`
+}
+
+type order struct {
+	Id    int
+	Cards []*card
+	Note  map[string]card
+}
+
+type point struct {
+	X, Y int
+}
+
+func TestValue(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(Value(point{1, 2}), "{X:1 Y:2}")
+	is.Equal(Value(&card{"bob", "4111"}), "&{Holder:bob Number:***}")
+	is.Equal(Value(order{Id: 1, Cards: []*card{{"bob", "4111"}, nil}}),
+		"{Id:1 Cards:[&{Holder:bob Number:***} <nil>] Note:map[]}")
+	is.Equal(Value(map[string]card{"a": {"bob", "4111"}}), "map[a:{Holder:bob Number:***}]")
+	is.Equal(Value(nil), "<nil>")
+	is.Equal(Value([]byte("ab")), "[97 98]")
+}
+
+func TestArgs(t *testing.T) {
+	is := is.New(t)
+
+	MaskArgs("login", 1)
+	is.Equal(Args("login", []interface{}{"bob", "secret"}), "[bob ***]")
+	is.Equal(Args("other", []interface{}{"bob", "secret"}), "[bob secret]")
+
+	t1 := task.NewTask(nil, "login", "bob", "secret")
+	is.Equal(Task(t1), "login("+t1.Id+") [bob ***]")
+
+	SetHook(func(name string, v interface{}) interface{} {
+		if s, ok := v.(string); ok && strings.HasPrefix(s, "tok_") {
+			return Mask
+		}
+		return v
+	})
+	defer SetHook(nil)
+	is.Equal(Results("issue", []interface{}{"tok_123", 1}), "[*** 1]")
+	is.Equal(Args("other", []interface{}{"tok_123", &card{"bob", "4111"}}), "[*** &{Holder:bob Number:***}]")
+}
+
+func TestParams(t *testing.T) {
+	is := is.New(t)
+
+	types := []reflect.Type{reflect.TypeOf(&order{}), reflect.TypeOf(0)}
+	decoded := map[string]interface{}{
+		"Id": 1,
+		"Cards": []interface{}{
+			map[string]interface{}{"Holder": "bob", "Number": "4111"},
+		},
+		"Note": map[string]interface{}{
+			"a": map[string]interface{}{"Number": "4222", "Extra": "x"},
+		},
+	}
+	is.Equal(ArgsAs("pay", []interface{}{decoded, 100}, types),
+		"[map[Cards:[map[Holder:bob Number:***]] Id:1 Note:map[a:map[Extra:x Number:***]]] 100]")
+	// 原始类型的参数按 tag 脱敏
+	is.Equal(ArgsAs("pay", []interface{}{&order{Id: 1}, 100}, types), "[&{Id:1 Cards:[] Note:map[]} 100]")
+	// 类型只属于传入它的 app，不影响其它同名的任务
+	is.True(strings.Contains(Args("pay", []interface{}{decoded, 100}), "4111"))
+}
@@ -0,0 +1,342 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/zigzed/asq/task"
+)
+
+const (
+	// 撤销标记的保留时间，应该长于任务的最大延迟
+	revokeTTL = 7 * 24 * time.Hour
+	// 暂停时检查恢复的间隔
+	pausePeriod = time.Second
+	// 按 id 扫描死信和延迟队列的分页大小
+	scanPage = 100
+	// 死信队列的默认长度
+	defaultDeadLetterLen = 10000
+)
+
+// Name returns the name of the queue.
+func (b *broker) Name() string {
+	return b.name
+}
+
+// Peek returns the waiting tasks without consuming them, from the next one
+// to be polled.
+func (b *broker) Peek(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	// BRPOP 从右端取任务，按执行顺序从右往左读
+	bufs, err := b.rdb.LRange(ctx, b.makeTaskKeyForBroker(), -(offset + count), -(offset + 1)).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "peek broker %s failed", b.name)
+	}
+	for i, j := 0, len(bufs)-1; i < j; i, j = i+1, j-1 {
+		bufs[i], bufs[j] = bufs[j], bufs[i]
+	}
+	return b.inspectAll(ctx, bufs)
+}
+
+// PeekDelayed returns the delayed tasks, from the earliest due.
+func (b *broker) PeekDelayed(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	bufs, err := b.rdb.ZRange(ctx, b.makeDelayedKeyForBroker(), offset, offset+count-1).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "peek delayed of broker %s failed", b.name)
+	}
+	return b.inspectAll(ctx, bufs)
+}
+
+// DeadLen returns the number of tasks in {queue}.dead.
+func (b *broker) DeadLen(ctx context.Context) (int64, error) {
+	n, err := b.rdb.LLen(ctx, b.makeDeadKeyForBroker()).Result()
+	if err != nil {
+		return 0, errors.Wrapf(err, "dead length of broker %s failed", b.name)
+	}
+	return n, nil
+}
+
+// DeadLetters returns the dead lettered tasks, from the latest one.
+func (b *broker) DeadLetters(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	bufs, err := b.rdb.LRange(ctx, b.makeDeadKeyForBroker(), offset, offset+count-1).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "peek dead letters of broker %s failed", b.name)
+	}
+	return b.inspectAll(ctx, bufs)
+}
+
+// Requeue moves the dead lettered task back to the queue with its attempts
+// reset, it returns false if the task is not found.
+func (b *broker) Requeue(ctx context.Context, id string) (bool, error) {
+	key := b.makeDeadKeyForBroker()
+	for start := int64(0); ; start += scanPage {
+		bufs, err := b.rdb.LRange(ctx, key, start, start+scanPage-1).Result()
+		if err != nil {
+			return false, errors.Wrapf(err, "scan dead letters of broker %s failed", b.name)
+		}
+		if len(bufs) == 0 {
+			return false, nil
+		}
+
+		for _, buf := range bufs {
+			t, blobKey, err := b.inspect(ctx, buf)
+			if err != nil || t.Id != id {
+				continue
+			}
+
+			delete(t.Headers, "asq-error")
+			t.BackOff = nil
+			t.EnsureBackOff()
+			t.Option.StartAt = nil
+			t.SubmittedAt = time.Now().UnixMilli()
+			requeued, err := b.encode(ctx, t, b.blobTTL(t))
+			if err != nil {
+				return false, err
+			}
+
+			// 移除死信和推送在同一个脚本中完成，失败时死信还在
+			script := `
+			if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+				return 0
+			end
+			redis.call('LPUSH', KEYS[2], ARGV[2])
+			return 1
+			`
+			n, err := b.rdb.Eval(ctx, script,
+				[]string{key, b.makeTaskKeyForBroker()}, buf, requeued).Int()
+			if err != nil || n == 0 {
+				b.releaseAll(ctx, []string{requeued})
+			}
+			if err != nil {
+				return false, errors.Wrapf(err, "requeue %s, %s failed", t.Name, t.Id)
+			}
+			// 被其他调用者抢先移走了
+			if n == 0 {
+				return false, nil
+			}
+			release(ctx, &b.opt, blobKey)
+			return true, nil
+		}
+	}
+}
+
+// Reschedule moves the delayed task to run at the given time, it returns
+// false if the task is not found.
+func (b *broker) Reschedule(ctx context.Context, id string, at time.Time) (bool, error) {
+	key := b.makeDelayedKeyForBroker()
+	for start := int64(0); ; start += scanPage {
+		bufs, err := b.rdb.ZRange(ctx, key, start, start+scanPage-1).Result()
+		if err != nil {
+			return false, errors.Wrapf(err, "scan delayed of broker %s failed", b.name)
+		}
+		if len(bufs) == 0 {
+			return false, nil
+		}
+
+		for _, buf := range bufs {
+			t, blobKey, err := b.inspect(ctx, buf)
+			if err != nil || t.Id != id {
+				continue
+			}
+
+			t.Option.WithStartAt(at)
+			rescheduled, err := b.encode(ctx, t, b.blobTTL(t))
+			if err != nil {
+				return false, err
+			}
+
+			script := `
+			if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+				return 0
+			end
+			redis.call('ZADD', KEYS[1], ARGV[3], ARGV[2])
+			return 1
+			`
+			n, err := b.rdb.Eval(ctx, script,
+				[]string{key}, buf, rescheduled, *t.Option.StartAt).Int()
+			if err != nil || n == 0 {
+				b.releaseAll(ctx, []string{rescheduled})
+			}
+			if err != nil {
+				return false, errors.Wrapf(err, "reschedule %s, %s failed", t.Name, t.Id)
+			}
+			if n == 0 {
+				return false, nil
+			}
+			release(ctx, &b.opt, blobKey)
+			return true, nil
+		}
+	}
+}
+
+// Purge deletes the waiting tasks and returns their number, blobs of the
+// tasks expire with BlobTTL.
+func (b *broker) Purge(ctx context.Context) (int64, error) {
+	return b.purge(ctx, b.makeTaskKeyForBroker(), true)
+}
+
+func (b *broker) PurgeDelayed(ctx context.Context) (int64, error) {
+	return b.purge(ctx, b.makeDelayedKeyForBroker(), false)
+}
+
+// PurgeDead deletes the dead letters with their blobs, which don't expire.
+func (b *broker) PurgeDead(ctx context.Context) (int64, error) {
+	key := b.makeDeadKeyForBroker()
+	var bufs *redis.StringSliceCmd
+	if _, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		bufs = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, "purge %s of broker %s failed", key, b.name)
+	}
+	b.releaseAll(ctx, bufs.Val())
+	return int64(len(bufs.Val())), nil
+}
+
+func (b *broker) purge(ctx context.Context, key string, list bool) (int64, error) {
+	var n *redis.IntCmd
+	if _, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if list {
+			n = pipe.LLen(ctx, key)
+		} else {
+			n = pipe.ZCard(ctx, key)
+		}
+		pipe.Del(ctx, key)
+		return nil
+	}); err != nil {
+		return 0, errors.Wrapf(err, "purge %s of broker %s failed", key, b.name)
+	}
+	return n.Val(), nil
+}
+
+// Revoke marks the task as revoked, the worker drops it when polled instead
+// of executing. The mark is kept for 7 days.
+func (b *broker) Revoke(ctx context.Context, id string) error {
+	if _, err := b.rdb.Set(ctx, b.makeRevokedKeyForBroker(id), 1, revokeTTL).Result(); err != nil {
+		return errors.Wrapf(err, "revoke task %s of broker %s failed", id, b.name)
+	}
+	return nil
+}
+
+func (b *broker) Revoked(ctx context.Context, id string) (bool, error) {
+	n, err := b.rdb.Exists(ctx, b.makeRevokedKeyForBroker(id)).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "check revoked task %s of broker %s failed", id, b.name)
+	}
+	return n > 0, nil
+}
+
+// Pause stops the consumption of the queue by all workers until Resume,
+// tasks can still be pushed.
+func (b *broker) Pause(ctx context.Context) error {
+	if _, err := b.rdb.Set(ctx, b.makePausedKeyForBroker(), 1, 0).Result(); err != nil {
+		return errors.Wrapf(err, "pause broker %s failed", b.name)
+	}
+	return nil
+}
+
+func (b *broker) Resume(ctx context.Context) error {
+	if _, err := b.rdb.Del(ctx, b.makePausedKeyForBroker()).Result(); err != nil {
+		return errors.Wrapf(err, "resume broker %s failed", b.name)
+	}
+	return nil
+}
+
+func (b *broker) Paused(ctx context.Context) (bool, error) {
+	n, err := b.rdb.Exists(ctx, b.makePausedKeyForBroker()).Result()
+	if err != nil {
+		return false, errors.Wrapf(err, "check paused broker %s failed", b.name)
+	}
+	return n > 0, nil
+}
+
+// waitPaused waits up to timeout while the queue is paused.
+func (b *broker) waitPaused(ctx context.Context, timeout time.Duration) {
+	if timeout > pausePeriod {
+		timeout = pausePeriod
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(timeout):
+	}
+}
+
+// inspect decodes the task in buf without consuming it, the blob key is
+// returned for the callers removing the task.
+func (b *broker) inspect(ctx context.Context, buf string) (*task.Task, string, error) {
+	if b.signer != nil {
+		payload, err := b.signer.open(buf)
+		if err != nil {
+			return nil, "", err
+		}
+		buf = payload
+	}
+
+	buf, blobKey, err := resolve(ctx, &b.opt, buf)
+	if err != nil {
+		return nil, "", err
+	}
+	t, err := b.opt.Marshaller.DecodeTask(buf)
+	if err != nil {
+		return nil, "", err
+	}
+	return t, blobKey, nil
+}
+
+// releaseAll deletes the blobs referenced by the removed tasks, without
+// fetching them.
+func (b *broker) releaseAll(ctx context.Context, bufs []string) {
+	for _, buf := range bufs {
+		if b.signer != nil {
+			payload, err := b.signer.open(buf)
+			if err != nil {
+				continue
+			}
+			buf = payload
+		}
+		if key, _, ok := reference(buf); ok {
+			release(ctx, &b.opt, key)
+		}
+	}
+}
+
+// inspectAll skips the tasks which could not be decoded, e.g. with an
+// invalid signature. It fails if none of them could, which is usually a
+// marshaller, blob store or key different from the producers'.
+func (b *broker) inspectAll(ctx context.Context, bufs []string) ([]*task.Task, error) {
+	tasks := make([]*task.Task, 0, len(bufs))
+	var failed error
+	for _, buf := range bufs {
+		t, _, err := b.inspect(ctx, buf)
+		if err != nil {
+			b.opt.logger().Warn("asq: inspect task failed", "queue", b.name, "error", err)
+			failed = err
+			continue
+		}
+		tasks = append(tasks, t)
+	}
+	if len(tasks) == 0 && failed != nil {
+		return nil, errors.Wrapf(failed, "decode %d tasks of broker %s failed", len(bufs), b.name)
+	}
+	return tasks, nil
+}
+
+func (b *broker) makeRevokedKeyForBroker(id string) string {
+	return fmt.Sprintf("{%s}.%s.%s", b.name, "revoked", id)
+}
+
+func (b *broker) makePausedKeyForBroker() string {
+	return fmt.Sprintf("{%s}.%s", b.name, "paused")
+}
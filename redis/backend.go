@@ -8,6 +8,7 @@ import (
 	"emperror.dev/errors"
 	"github.com/go-redis/redis/v8"
 	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/redact"
 	"github.com/zigzed/asq/result"
 )
 
@@ -36,7 +37,7 @@ func NewBackend(opt *Option, queueName string) (*backend, error) {
 	})
 
 	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
-		return nil, errors.Wrapf(err, "redis connection of %v failed", opt)
+		return nil, errors.Wrapf(err, "redis connection of %v failed", opt.Addrs)
 	}
 
 	return &backend{
@@ -51,8 +52,15 @@ func (b *backend) Push(ctx context.Context, result *result.Result) error {
 
 	buf, err := b.opt.Marshaller.EncodeResult(result.Results, result.Error)
 	if err != nil {
-		return errors.Wrapf(err, "encode result %v for %s, %s failed",
-			result.Results, result.Name, result.Id)
+		return errors.Wrapf(err, "encode result %s for %s, %s failed",
+			redact.Results(result.Name, result.Results), result.Name, result.Id)
+	}
+	ttl := result.Timeout
+	if ttl <= 0 {
+		ttl = defaultBlobTTL
+	}
+	if buf, err = offload(ctx, &b.opt, buf, ttl); err != nil {
+		return errors.Wrapf(err, "offload result for %s, %s failed", result.Name, result.Id)
 	}
 
 	if _, err := b.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
@@ -60,7 +68,7 @@ func (b *backend) Push(ctx context.Context, result *result.Result) error {
 		pipe.Expire(ctx, key, result.Timeout)
 		return nil
 	}); err != nil {
-		return errors.Wrapf(err, "push result %v failed", result)
+		return errors.Wrapf(err, "push result for %s, %s failed", result.Name, result.Id)
 	}
 
 	return nil
@@ -89,13 +97,18 @@ func (b *backend) Scan(ctx context.Context, id, name string, args ...interface{}
 		break
 	}
 	if len(res) != 2 {
-		return false, errors.Wrapf(err, "unsupported result for %s: %v", name, res)
+		return false, errors.Wrapf(err, "unsupported result for %s: %d values", name, len(res))
+	}
+
+	buf, blobKey, err := resolve(ctx, &b.opt, res[1])
+	if err != nil {
+		return true, errors.Wrapf(err, "resolve result for %s, %s failed", name, id)
 	}
+	defer release(ctx, &b.opt, blobKey)
 
-	ok, err := b.opt.Marshaller.DecodeResult(res[1], args...)
+	ok, err := b.opt.Marshaller.DecodeResult(buf, args...)
 	if !ok {
-		return true, errors.Wrapf(err, "unmarshal result for %s, %s, %s failed",
-			name, id, res)
+		return true, errors.Wrapf(err, "unmarshal result for %s, %s failed", name, id)
 	}
 
 	return true, err
@@ -0,0 +1,156 @@
+package redis
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/zigzed/asq/blob"
+)
+
+// 超过阈值的数据保存到 blob store，消息中只保存引用: magic, blob key, '.',
+// 数据的 sha256。签名覆盖了引用，也就覆盖了 blob 的内容
+const blobMagic = "\x00asqb"
+
+const (
+	defaultBlobThreshold = 64 * 1024
+	defaultBlobTTL       = 24 * time.Hour
+)
+
+type blobStore struct {
+	rdb redis.UniversalClient
+}
+
+// NewBlobStore stores blobs as redis keys, it is the simplest store when the
+// payloads are too large for the lists but not for the redis server.
+func NewBlobStore(opt *Option) (*blobStore, error) {
+	if opt == nil {
+		opt = DefaultOption()
+	}
+
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            opt.Addrs,
+		DB:               opt.DB,
+		Username:         opt.Username,
+		Password:         opt.Password,
+		SentinelUsername: opt.SentinelUsername,
+		SentinelPassword: opt.SentinelPassword,
+		MasterName:       opt.MasterName,
+	})
+
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		return nil, errors.Wrapf(err, "redis connection of %v failed", opt.Addrs)
+	}
+
+	return &blobStore{rdb: rdb}, nil
+}
+
+func (s *blobStore) Put(ctx context.Context, key string, data []byte, ttl time.Duration) error {
+	if _, err := s.rdb.Set(ctx, s.makeBlobKey(key), data, ttl).Result(); err != nil {
+		return errors.Wrapf(err, "put blob %s failed", key)
+	}
+	return nil
+}
+
+func (s *blobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := s.rdb.Get(ctx, s.makeBlobKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, errors.Wrapf(blob.ErrNotFound, "blob %s", key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get blob %s failed", key)
+	}
+	return data, nil
+}
+
+func (s *blobStore) Delete(ctx context.Context, key string) error {
+	if _, err := s.rdb.Del(ctx, s.makeBlobKey(key)).Result(); err != nil {
+		return errors.Wrapf(err, "delete blob %s failed", key)
+	}
+	return nil
+}
+
+func (s *blobStore) Close() error {
+	return s.rdb.Close()
+}
+
+func (s *blobStore) makeBlobKey(key string) string {
+	return "asq.blob." + key
+}
+
+// offload moves buf into the blob store if it is larger than the threshold
+// and returns the reference to put in the message instead. A zero ttl keeps
+// the blob until it is released.
+func offload(ctx context.Context, opt *Option, buf string, ttl time.Duration) (string, error) {
+	threshold := opt.BlobThreshold
+	if threshold <= 0 {
+		threshold = defaultBlobThreshold
+	}
+	if opt.BlobStore == nil || len(buf) <= threshold {
+		return buf, nil
+	}
+
+	key := uuid.New().String()
+	if err := opt.BlobStore.Put(ctx, key, []byte(buf), ttl); err != nil {
+		return "", err
+	}
+	return blobMagic + key + "." + digest(buf), nil
+}
+
+func digest(buf string) string {
+	sum := sha256.Sum256([]byte(buf))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolve returns the payload of a reference and the blob key, which is empty
+// for payloads kept in the message.
+func resolve(ctx context.Context, opt *Option, buf string) (string, string, error) {
+	if !strings.HasPrefix(buf, blobMagic) {
+		return buf, "", nil
+	}
+	if opt.BlobStore == nil {
+		return "", "", errors.Errorf("blob store is not configured for payload reference")
+	}
+
+	key, sum, ok := reference(buf)
+	if !ok {
+		return "", "", errors.Errorf("payload reference without digest")
+	}
+	data, err := opt.BlobStore.Get(ctx, key)
+	if err != nil {
+		return "", "", err
+	}
+	if digest(string(data)) != sum {
+		return "", "", errors.Errorf("blob %s does not match the digest of its reference", key)
+	}
+	return string(data), key, nil
+}
+
+// reference parses the blob key and digest of a payload reference.
+func reference(buf string) (string, string, bool) {
+	if !strings.HasPrefix(buf, blobMagic) {
+		return "", "", false
+	}
+	ref := buf[len(blobMagic):]
+	i := strings.LastIndexByte(ref, '.')
+	if i < 0 {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+// release deletes the blob after the payload is decoded, the blob expires
+// anyway if it fails.
+func release(ctx context.Context, opt *Option, key string) {
+	if key == "" {
+		return
+	}
+	if err := opt.BlobStore.Delete(ctx, key); err != nil {
+		opt.logger().Warn("asq: release blob failed", "blob", key, "error", err)
+	}
+}
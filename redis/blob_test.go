@@ -0,0 +1,52 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/blob"
+)
+
+func TestOffload(t *testing.T) {
+	is := is.New(t)
+	ctx := context.Background()
+
+	store, err := blob.NewFileStore(t.TempDir())
+	is.NoErr(err)
+	opt := &Option{BlobStore: store, BlobThreshold: 8}
+
+	buf, err := offload(ctx, opt, "small", 0)
+	is.NoErr(err)
+	is.Equal(buf, "small")
+	buf, key, err := resolve(ctx, opt, buf)
+	is.NoErr(err)
+	is.Equal(buf, "small")
+	is.Equal(key, "")
+
+	large := strings.Repeat("x", 1000)
+	ref, err := offload(ctx, opt, large, 0)
+	is.NoErr(err)
+	is.True(strings.HasPrefix(ref, blobMagic))
+	is.True(len(ref) < len(large))
+
+	buf, key, err = resolve(ctx, opt, ref)
+	is.NoErr(err)
+	is.Equal(buf, large)
+
+	// 篡改 blob 的内容无法通过校验
+	is.NoErr(store.Put(ctx, key, []byte(strings.Repeat("y", 1000)), 0))
+	_, _, err = resolve(ctx, opt, ref)
+	is.Err(err)
+	is.NoErr(store.Put(ctx, key, []byte(large), 0))
+
+	// 解码后删除 blob
+	release(ctx, opt, key)
+	_, _, err = resolve(ctx, opt, ref)
+	is.True(errors.Is(err, blob.ErrNotFound))
+
+	_, _, err = resolve(ctx, &Option{}, ref)
+	is.Err(err)
+}
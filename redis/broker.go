@@ -8,16 +8,17 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/go-redis/redis/v8"
-	"github.com/golang/glog"
 	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/redact"
 	"github.com/zigzed/asq/task"
 )
 
 type broker struct {
-	rdb  redis.UniversalClient
-	opt  Option
-	name string
-	once sync.Once
+	rdb    redis.UniversalClient
+	opt    Option
+	name   string
+	once   sync.Once
+	signer *signer
 }
 
 func NewBroker(opt *Option, queueName string) (*broker, error) {
@@ -39,41 +40,106 @@ func NewBroker(opt *Option, queueName string) (*broker, error) {
 	})
 
 	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
-		return nil, errors.Wrapf(err, "redis connection of %v failed", opt)
+		return nil, errors.Wrapf(err, "redis connection of %v failed", opt.Addrs)
 	}
 
 	return &broker{
-		rdb:  rdb,
-		opt:  *opt,
-		name: queueName,
+		rdb:    rdb,
+		opt:    *opt,
+		name:   queueName,
+		signer: newSigner(opt),
 	}, nil
 }
 
 func (b *broker) Push(ctx context.Context, task *task.Task) error {
 	key := b.makeTaskKeyForBroker()
-	buf, err := b.opt.Marshaller.EncodeTask(task)
+	buf, err := b.encode(ctx, task, b.blobTTL(task))
 	if err != nil {
-		return errors.Wrapf(err, "encode task %v failed", task)
+		return err
 	}
 
 	if task.Option.StartAt == nil {
 		if _, err := b.rdb.LPush(ctx, key, buf).Result(); err != nil {
-			return errors.Wrapf(err, "broker push %s, %s with %s failed",
-				task.Name, task.Id, buf)
+			return errors.Wrapf(err, "broker push %s, %s failed",
+				task.Name, task.Id)
 		}
 	} else {
 		if _, err := b.rdb.ZAdd(ctx, b.makeDelayedKeyForBroker(), &redis.Z{
 			Member: buf,
 			Score:  float64(*task.Option.StartAt),
 		}).Result(); err != nil {
-			return errors.Wrapf(err, "broker push %s, %s with %s failed",
-				task.Name, task.Id, buf)
+			return errors.Wrapf(err, "broker push %s, %s failed",
+				task.Name, task.Id)
 		}
 	}
 
 	return nil
 }
 
+// DeadLetter keeps the task given up after all retries in {queue}.dead, the
+// reason is recorded in the asq-error header. The list is trimmed to
+// DeadLetterLen tasks (10000 by default).
+func (b *broker) DeadLetter(ctx context.Context, task *task.Task, reason error) error {
+	if reason != nil {
+		task.SetHeader("asq-error", reason.Error())
+	}
+	// 死信的 blob 不过期，随死信一起删除
+	buf, err := b.encode(ctx, task, 0)
+	if err != nil {
+		return err
+	}
+
+	key := b.makeDeadKeyForBroker()
+	max := b.opt.DeadLetterLen
+	if max <= 0 {
+		max = defaultDeadLetterLen
+	}
+	var trimmed *redis.StringSliceCmd
+	if _, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, buf)
+		trimmed = pipe.LRange(ctx, key, max, -1)
+		pipe.LTrim(ctx, key, 0, max-1)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "dead letter %s, %s to broker %s failed",
+			task.Name, task.Id, b.name)
+	}
+	b.releaseAll(ctx, trimmed.Val())
+	return nil
+}
+
+// Len returns the number of tasks waiting in {queue}.tasks.
+func (b *broker) Len(ctx context.Context) (int64, error) {
+	n, err := b.rdb.LLen(ctx, b.makeTaskKeyForBroker()).Result()
+	if err != nil {
+		return 0, errors.Wrapf(err, "length of broker %s failed", b.name)
+	}
+	return n, nil
+}
+
+// DelayedLen returns the number of tasks scheduled in {queue}.delayed.
+func (b *broker) DelayedLen(ctx context.Context) (int64, error) {
+	n, err := b.rdb.ZCard(ctx, b.makeDelayedKeyForBroker()).Result()
+	if err != nil {
+		return 0, errors.Wrapf(err, "delayed length of broker %s failed", b.name)
+	}
+	return n, nil
+}
+
+func (b *broker) encode(ctx context.Context, task *task.Task, ttl time.Duration) (string, error) {
+	buf, err := b.opt.Marshaller.EncodeTask(task)
+	if err != nil {
+		return "", errors.Wrapf(err, "encode task %s failed", redact.Task(task))
+	}
+	if buf, err = offload(ctx, &b.opt, buf, ttl); err != nil {
+		return "", errors.Wrapf(err, "offload task %s, %s failed", task.Name, task.Id)
+	}
+	if b.signer != nil {
+		buf = b.signer.sign(buf)
+	}
+	return buf, nil
+}
+
 func (b *broker) Poll(ctx context.Context, timeout time.Duration) (*task.Task, error) {
 	return b.doPoll(ctx, timeout)
 }
@@ -87,6 +153,13 @@ func (b *broker) doPoll(ctx context.Context, timeout time.Duration) (*task.Task,
 		b.startMoveDelayed(ctx)
 	})
 
+	if paused, err := b.Paused(ctx); err != nil {
+		return nil, err
+	} else if paused {
+		b.waitPaused(ctx, timeout)
+		return nil, nil
+	}
+
 	buf, err := b.fetchTasks(ctx, timeout)
 	if err != nil {
 		return nil, err
@@ -95,13 +168,49 @@ func (b *broker) doPoll(ctx context.Context, timeout time.Duration) (*task.Task,
 		return nil, nil
 	}
 
+	if b.signer != nil {
+		payload, err := b.signer.open(buf)
+		if err != nil {
+			return nil, b.quarantine(ctx, buf, err)
+		}
+		buf = payload
+	}
+
+	buf, blobKey, err := resolve(ctx, &b.opt, buf)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolve task of broker %s failed", b.name)
+	}
+	defer release(ctx, &b.opt, blobKey)
+
 	if task, err := b.opt.Marshaller.DecodeTask(buf); err != nil {
-		return nil, errors.Wrapf(err, "unmarshal task %s failed", buf)
+		return nil, errors.Wrapf(err, "unmarshal task of %d bytes failed", len(buf))
 	} else {
 		return task, nil
 	}
 }
 
+// blobTTL keeps the blob of a delayed task until it is due.
+func (b *broker) blobTTL(task *task.Task) time.Duration {
+	ttl := b.opt.BlobTTL
+	if ttl <= 0 {
+		ttl = defaultBlobTTL
+	}
+	if task.Option.StartAt != nil {
+		ttl += time.Until(time.UnixMilli(*task.Option.StartAt))
+	}
+	return ttl
+}
+
+// quarantine keeps the rejected task for inspection instead of dropping it.
+func (b *broker) quarantine(ctx context.Context, buf string, reason error) error {
+	key := b.makeQuarantineKeyForBroker()
+	if _, err := b.rdb.LPush(ctx, key, buf).Result(); err != nil {
+		return errors.Wrapf(reason, "reject task of broker %s, quarantine to %s failed: %v",
+			b.name, key, err)
+	}
+	return errors.Wrapf(reason, "reject task of broker %s, quarantined to %s", b.name, key)
+}
+
 func (b *broker) startMoveDelayed(ctx context.Context) {
 	taskKey := b.makeTaskKeyForBroker()
 	delayed := b.makeDelayedKeyForBroker()
@@ -116,8 +225,8 @@ func (b *broker) startMoveDelayed(ctx context.Context) {
 				break Loop
 			case <-tick.C:
 				if err := b.moveDelayed(ctx, delayed, taskKey); err != nil {
-					glog.Warningf("move delayed from %s to %s failed: %v",
-						delayed, taskKey, err)
+					b.opt.logger().Warn("asq: move delayed tasks failed",
+						"from", delayed, "to", taskKey, "error", err)
 				}
 			}
 		}
@@ -171,3 +280,11 @@ func (b *broker) makeTaskKeyForBroker() string {
 func (b *broker) makeDelayedKeyForBroker() string {
 	return fmt.Sprintf("{%s}.%s", b.name, "delayed")
 }
+
+func (b *broker) makeQuarantineKeyForBroker() string {
+	return fmt.Sprintf("{%s}.%s", b.name, "quarantine")
+}
+
+func (b *broker) makeDeadKeyForBroker() string {
+	return fmt.Sprintf("{%s}.%s", b.name, "dead")
+}
@@ -3,6 +3,8 @@ package redis
 import (
 	"time"
 
+	"github.com/zigzed/asq/blob"
+	"github.com/zigzed/asq/log"
 	"github.com/zigzed/asq/marshaller"
 )
 
@@ -16,6 +18,42 @@ type Option struct {
 	MasterName       string
 	Marshaller       marshaller.Marshaller
 	PollPeriod       time.Duration
+	// Logger defaults to log.Default(), NewAppFromRedis sets the app logger
+	Logger log.Logger
+
+	// SigningKey enables HMAC signing of the pushed tasks, polled tasks
+	// without a valid signature are quarantined. VerifyKeys are the old keys
+	// still accepted when rotating, AcceptUnsigned accepts tasks pushed
+	// before signing was enabled.
+	SigningKey     []byte
+	VerifyKeys     [][]byte
+	AcceptUnsigned bool
+
+	// BlobStore enables offloading of encoded tasks and results larger than
+	// BlobThreshold bytes (64KiB by default), the message only keeps a
+	// reference. Result blobs expire with the result, task blobs are deleted
+	// when polled or expire after BlobTTL (24 hours by default) if never
+	// polled.
+	BlobStore     blob.Store
+	BlobThreshold int
+	BlobTTL       time.Duration
+
+	// Registry enables the asq.workers hash by NewAppFromRedis, the workers
+	// heartbeat into it and App.Workers lists them.
+	Registry bool
+
+	// Control enables the {queue}.control channel by NewAppFromRedis, the
+	// workers receive the commands of App.Broadcast on it.
+	Control bool
+
+	// DeadLetterLen enables the {queue}.dead list by NewAppFromRedis, only the
+	// latest DeadLetterLen tasks given up after all retries are kept. Their
+	// blobs don't expire, they are deleted with the dead letters.
+	DeadLetterLen int64
+
+	// StateTTL enables recording of the task states in the backend by
+	// NewAppFromRedis, a state is kept for StateTTL after its last update.
+	StateTTL time.Duration
 }
 
 func DefaultOption() *Option {
@@ -25,3 +63,10 @@ func DefaultOption() *Option {
 		PollPeriod: 100 * time.Millisecond,
 	}
 }
+
+func (opt *Option) logger() log.Logger {
+	if opt.Logger == nil {
+		return log.Default()
+	}
+	return opt.Logger
+}
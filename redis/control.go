@@ -0,0 +1,213 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/zigzed/asq/control"
+)
+
+// 回复的发送超时，不受 Listen 的 ctx 影响，shutdown 之后也能回复
+const replyTimeout = 5 * time.Second
+
+// 签名的命令在 commandMaxAge 内有效，期间按 id 去重，防止重放
+const commandMaxAge = time.Minute
+
+type controlChannel struct {
+	rdb    redis.UniversalClient
+	opt    Option
+	name   string
+	signer *signer
+
+	mu   sync.Mutex
+	seen map[string]int64
+}
+
+// NewControl broadcasts the commands on the {queue}.control channel, the
+// replies are published on a channel per command. Commands are signed like
+// the tasks if SigningKey is set, the workers drop the others, and the ones
+// issued more than a minute ago or seen already.
+func NewControl(opt *Option, queueName string) (*controlChannel, error) {
+	if opt == nil {
+		opt = DefaultOption()
+	}
+
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            opt.Addrs,
+		DB:               opt.DB,
+		Username:         opt.Username,
+		Password:         opt.Password,
+		SentinelUsername: opt.SentinelUsername,
+		SentinelPassword: opt.SentinelPassword,
+		MasterName:       opt.MasterName,
+	})
+
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		return nil, errors.Wrapf(err, "redis connection of %v failed", opt.Addrs)
+	}
+
+	return &controlChannel{rdb: rdb, opt: *opt, name: queueName, signer: newSigner(opt)}, nil
+}
+
+func (c *controlChannel) Listen(ctx context.Context, handle func(cmd *control.Command) *control.Reply) error {
+	sub := c.rdb.Subscribe(ctx, c.makeControlChannel())
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return errors.Wrapf(err, "subscribe control of %s failed", c.name)
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			cmd, err := c.decode(msg.Payload)
+			if err != nil {
+				c.opt.logger().Warn("asq: decode control command failed", "queue", c.name, "error", err)
+				continue
+			}
+			if reply := handle(cmd); reply != nil {
+				c.reply(cmd, reply)
+			}
+		}
+	}
+}
+
+func (c *controlChannel) reply(cmd *control.Command, reply *control.Reply) {
+	ctx, cancel := context.WithTimeout(context.Background(), replyTimeout)
+	defer cancel()
+
+	buf, err := json.Marshal(reply)
+	if err == nil {
+		err = c.rdb.Publish(ctx, c.makeReplyChannel(cmd.Id), buf).Err()
+	}
+	if err != nil {
+		c.opt.logger().Warn("asq: reply control command failed",
+			"queue", c.name, "command", cmd.Name, "id", cmd.Id, "error", err)
+	}
+}
+
+func (c *controlChannel) Send(ctx context.Context, cmd *control.Command, timeout time.Duration) ([]*control.Reply, error) {
+	if cmd.Id == "" {
+		cmd.Id = uuid.New().String()
+	}
+	buf, err := c.encode(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先订阅回复再发送命令，避免丢失回复
+	sub := c.rdb.Subscribe(ctx, c.makeReplyChannel(cmd.Id))
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return nil, errors.Wrapf(err, "subscribe replies of %s failed", cmd.Name)
+	}
+	if err := c.rdb.Publish(ctx, c.makeControlChannel(), buf).Err(); err != nil {
+		return nil, errors.Wrapf(err, "send control command %s to %s failed", cmd.Name, c.name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ch := sub.Channel()
+	var replies []*control.Reply
+	for len(cmd.Workers) == 0 || len(replies) < len(cmd.Workers) {
+		select {
+		case <-ctx.Done():
+			return replies, nil
+		case msg, ok := <-ch:
+			if !ok {
+				return replies, nil
+			}
+			var reply control.Reply
+			if err := json.Unmarshal([]byte(msg.Payload), &reply); err != nil {
+				c.opt.logger().Warn("asq: decode control reply failed", "queue", c.name, "error", err)
+				continue
+			}
+			replies = append(replies, &reply)
+		}
+	}
+	return replies, nil
+}
+
+func (c *controlChannel) encode(cmd *control.Command) (string, error) {
+	cmd.IssuedAt = time.Now().UnixMilli()
+	buf, err := json.Marshal(cmd)
+	if err != nil {
+		return "", errors.Wrapf(err, "encode control command %s failed", cmd.Name)
+	}
+	if c.signer != nil {
+		return c.signer.sign(string(buf)), nil
+	}
+	return string(buf), nil
+}
+
+func (c *controlChannel) decode(payload string) (*control.Command, error) {
+	signed := false
+	if c.signer != nil {
+		signed = strings.HasPrefix(payload, signMagic)
+		buf, err := c.signer.open(payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = buf
+	}
+	var cmd control.Command
+	if err := json.Unmarshal([]byte(payload), &cmd); err != nil {
+		return nil, err
+	}
+	if signed {
+		if err := c.replayed(&cmd, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return &cmd, nil
+}
+
+// replayed rejects the signed commands issued out of commandMaxAge, or with an
+// id seen in it.
+func (c *controlChannel) replayed(cmd *control.Command, now time.Time) error {
+	issued := time.UnixMilli(cmd.IssuedAt)
+	if cmd.IssuedAt == 0 || now.Sub(issued) > commandMaxAge || issued.Sub(now) > commandMaxAge {
+		return errors.Errorf("control command %s issued at %v expired", cmd.Id, issued)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen == nil {
+		c.seen = make(map[string]int64)
+	}
+	for id, at := range c.seen {
+		if now.Sub(time.UnixMilli(at)) > commandMaxAge {
+			delete(c.seen, id)
+		}
+	}
+	if _, ok := c.seen[cmd.Id]; ok {
+		return errors.Errorf("control command %s replayed", cmd.Id)
+	}
+	c.seen[cmd.Id] = cmd.IssuedAt
+	return nil
+}
+
+func (c *controlChannel) Close() error {
+	return c.rdb.Close()
+}
+
+func (c *controlChannel) makeControlChannel() string {
+	return fmt.Sprintf("{%s}.%s", c.name, "control")
+}
+
+func (c *controlChannel) makeReplyChannel(id string) string {
+	return fmt.Sprintf("{%s}.%s.%s", c.name, "reply", id)
+}
@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/zigzed/asq/registry"
+)
+
+const (
+	// 所有队列的 worker 保存在一个 hash 中
+	workersKey = "asq.workers"
+	// 停止心跳超过这个时间的 worker 从列表中删除
+	deadRetention = time.Hour
+)
+
+type workerRegistry struct {
+	rdb redis.UniversalClient
+	opt Option
+}
+
+// NewRegistry keeps the workers in the asq.workers hash, shared by all the
+// queues of the redis database. Dead workers are listed for an hour after
+// their last heartbeat.
+func NewRegistry(opt *Option) (*workerRegistry, error) {
+	if opt == nil {
+		opt = DefaultOption()
+	}
+
+	rdb := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs:            opt.Addrs,
+		DB:               opt.DB,
+		Username:         opt.Username,
+		Password:         opt.Password,
+		SentinelUsername: opt.SentinelUsername,
+		SentinelPassword: opt.SentinelPassword,
+		MasterName:       opt.MasterName,
+	})
+
+	if _, err := rdb.Ping(context.Background()).Result(); err != nil {
+		return nil, errors.Wrapf(err, "redis connection of %v failed", opt.Addrs)
+	}
+
+	return &workerRegistry{rdb: rdb, opt: *opt}, nil
+}
+
+func (r *workerRegistry) Heartbeat(ctx context.Context, w *registry.Worker) error {
+	buf, err := json.Marshal(w)
+	if err != nil {
+		return errors.Wrapf(err, "encode worker %s failed", w.Id)
+	}
+	if _, err := r.rdb.HSet(ctx, workersKey, w.Id, buf).Result(); err != nil {
+		return errors.Wrapf(err, "heartbeat of worker %s failed", w.Id)
+	}
+	return nil
+}
+
+func (r *workerRegistry) Unregister(ctx context.Context, id string) error {
+	if _, err := r.rdb.HDel(ctx, workersKey, id).Result(); err != nil {
+		return errors.Wrapf(err, "unregister worker %s failed", id)
+	}
+	return nil
+}
+
+// Workers returns the workers sorted by id, workers dead for more than an
+// hour are removed.
+func (r *workerRegistry) Workers(ctx context.Context) ([]*registry.Worker, error) {
+	all, err := r.rdb.HGetAll(ctx, workersKey).Result()
+	if err != nil {
+		return nil, errors.Wrapf(err, "list workers failed")
+	}
+
+	now := time.Now()
+	workers := make([]*registry.Worker, 0, len(all))
+	for id, buf := range all {
+		var w registry.Worker
+		if err := json.Unmarshal([]byte(buf), &w); err != nil {
+			r.opt.logger().Warn("asq: decode worker failed", "worker", id, "error", err)
+			continue
+		}
+		if now.Sub(w.Heartbeat) > w.TTL+deadRetention {
+			if err := r.Unregister(ctx, id); err != nil {
+				r.opt.logger().Warn("asq: remove dead worker failed", "worker", id, "error", err)
+			}
+			continue
+		}
+		workers = append(workers, &w)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].Id < workers[j].Id
+	})
+	return workers, nil
+}
+
+func (r *workerRegistry) Close() error {
+	return r.rdb.Close()
+}
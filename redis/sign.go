@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// ErrInvalidSignature is returned by Poll for tasks that fail verification,
+// the task is moved to the {queue}.quarantine list.
+var ErrInvalidSignature = errors.New("invalid task signature")
+
+// 签名后的任务格式: magic, HMAC-SHA256(payload), payload
+const signMagic = "\x00asqs"
+
+type signer struct {
+	key      []byte
+	verify   [][]byte
+	unsigned bool
+}
+
+func newSigner(opt *Option) *signer {
+	if len(opt.SigningKey) == 0 {
+		return nil
+	}
+	return &signer{
+		key:      opt.SigningKey,
+		verify:   append([][]byte{opt.SigningKey}, opt.VerifyKeys...),
+		unsigned: opt.AcceptUnsigned,
+	}
+}
+
+func (s *signer) sign(buf string) string {
+	return signMagic + string(mac(s.key, buf)) + buf
+}
+
+func (s *signer) open(buf string) (string, error) {
+	if !strings.HasPrefix(buf, signMagic) {
+		if s.unsigned {
+			return buf, nil
+		}
+		return "", errors.Wrap(ErrInvalidSignature, "task is not signed")
+	}
+
+	buf = buf[len(signMagic):]
+	if len(buf) < sha256.Size {
+		return "", errors.Wrap(ErrInvalidSignature, "task signature truncated")
+	}
+	sum, payload := []byte(buf[:sha256.Size]), buf[sha256.Size:]
+	for _, key := range s.verify {
+		if hmac.Equal(sum, mac(key, payload)) {
+			return payload, nil
+		}
+	}
+	return "", ErrInvalidSignature
+}
+
+func mac(key []byte, buf string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(buf))
+	return h.Sum(nil)
+}
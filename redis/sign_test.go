@@ -0,0 +1,89 @@
+package redis
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/control"
+)
+
+func TestSigner(t *testing.T) {
+	is := is.New(t)
+
+	is.Nil(newSigner(&Option{}))
+
+	old := newSigner(&Option{SigningKey: []byte("old")})
+	cur := newSigner(&Option{SigningKey: []byte("new"), VerifyKeys: [][]byte{[]byte("old")}})
+
+	buf := old.sign(`{"name":"login"}`)
+	payload, err := cur.open(buf)
+	is.NoErr(err)
+	is.Equal(payload, `{"name":"login"}`)
+
+	_, err = old.open(cur.sign(`{"name":"login"}`))
+	is.True(errors.Is(err, ErrInvalidSignature))
+
+	// 篡改的任务
+	_, err = cur.open(buf[:len(buf)-7] + `admin"}`)
+	is.True(errors.Is(err, ErrInvalidSignature))
+
+	_, err = cur.open(`{"name":"login"}`)
+	is.True(errors.Is(err, ErrInvalidSignature))
+	_, err = cur.open(signMagic + "short")
+	is.True(errors.Is(err, ErrInvalidSignature))
+
+	cur.unsigned = true
+	payload, err = cur.open(`{"name":"login"}`)
+	is.NoErr(err)
+	is.Equal(payload, `{"name":"login"}`)
+}
+
+func TestSignedCommand(t *testing.T) {
+	is := is.New(t)
+
+	signed := &controlChannel{signer: newSigner(&Option{SigningKey: []byte("key")})}
+	forged := &controlChannel{signer: newSigner(&Option{SigningKey: []byte("other")})}
+	plain := &controlChannel{}
+
+	buf, err := signed.encode(control.NewShutdown("w1"))
+	is.NoErr(err)
+	cmd, err := signed.decode(buf)
+	is.NoErr(err)
+	is.Equal(cmd.Name, control.Shutdown)
+	is.Equal(cmd.Workers, []string{"w1"})
+
+	// 没有签名或者密钥不对的命令被拒绝
+	buf, err = plain.encode(control.NewShutdown())
+	is.NoErr(err)
+	_, err = signed.decode(buf)
+	is.True(errors.Is(err, ErrInvalidSignature))
+	buf, err = forged.encode(control.NewShutdown())
+	is.NoErr(err)
+	_, err = signed.decode(buf)
+	is.True(errors.Is(err, ErrInvalidSignature))
+
+	// 重放的命令和过期的命令被拒绝
+	cmd = control.NewPause()
+	cmd.Id = "c1"
+	buf, err = signed.encode(cmd)
+	is.NoErr(err)
+	_, err = signed.decode(buf)
+	is.NoErr(err)
+	_, err = signed.decode(buf)
+	is.Err(err)
+
+	cmd.Id = "c2"
+	cmd.IssuedAt = time.Now().Add(-2 * commandMaxAge).UnixMilli()
+	old, err := json.Marshal(cmd)
+	is.NoErr(err)
+	_, err = signed.decode(signed.signer.sign(string(old)))
+	is.Err(err)
+	cmd.IssuedAt = 0
+	old, err = json.Marshal(cmd)
+	is.NoErr(err)
+	_, err = signed.decode(signed.signer.sign(string(old)))
+	is.Err(err)
+}
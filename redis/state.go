@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/zigzed/asq/task"
+)
+
+// 未设置 StateTTL 时状态的保留时间
+const defaultStateTTL = 24 * time.Hour
+
+// SetState records the state of a task in {queue}.state.<id>, and publishes
+// it to {queue}.states for WatchStates.
+func (b *backend) SetState(ctx context.Context, st *task.State) error {
+	buf, err := json.Marshal(st)
+	if err != nil {
+		return errors.Wrapf(err, "encode state of %s, %s failed", st.Name, st.Id)
+	}
+
+	ttl := b.opt.StateTTL
+	if ttl <= 0 {
+		ttl = defaultStateTTL
+	}
+	if _, err := b.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, b.makeStateKeyForBackend(st.Id), buf, ttl)
+		pipe.Publish(ctx, b.makeStateChannelForBackend(), buf)
+		return nil
+	}); err != nil {
+		return errors.Wrapf(err, "set state of %s, %s failed", st.Name, st.Id)
+	}
+	return nil
+}
+
+// State returns the last recorded state of the task, nil if unknown.
+func (b *backend) State(ctx context.Context, id string) (*task.State, error) {
+	buf, err := b.rdb.Get(ctx, b.makeStateKeyForBackend(id)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "get state of %s failed", id)
+	}
+
+	var st task.State
+	if err := json.Unmarshal([]byte(buf), &st); err != nil {
+		return nil, errors.Wrapf(err, "decode state of %s failed", id)
+	}
+	return &st, nil
+}
+
+// WatchStates calls fn with the states recorded by all workers until ctx is
+// done, states recorded while not watching are missed.
+func (b *backend) WatchStates(ctx context.Context, fn func(st *task.State)) error {
+	sub := b.rdb.Subscribe(ctx, b.makeStateChannelForBackend())
+	defer sub.Close()
+	if _, err := sub.Receive(ctx); err != nil {
+		return errors.Wrapf(err, "subscribe states of %s failed", b.name)
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var st task.State
+			if err := json.Unmarshal([]byte(msg.Payload), &st); err != nil {
+				b.opt.logger().Warn("asq: decode published state failed", "queue", b.name, "error", err)
+				continue
+			}
+			fn(&st)
+		}
+	}
+}
+
+func (b *backend) makeStateChannelForBackend() string {
+	return fmt.Sprintf("{%s}.%s", b.name, "states")
+}
+
+func (b *backend) makeStateKeyForBackend(id string) string {
+	return fmt.Sprintf("{%s}.%s.%s", b.name, "state", id)
+}
@@ -0,0 +1,46 @@
+// Package registry keeps the presence of the running workers, each worker
+// heartbeats its description and the tasks it is executing.
+package registry
+
+import (
+	"context"
+	"time"
+)
+
+// Worker describes a running worker, as of its last heartbeat.
+type Worker struct {
+	Id          string   `json:"id"`
+	Hostname    string   `json:"hostname"`
+	Pid         int      `json:"pid"`
+	Concurrency int      `json:"concurrency"`
+	Queues      []string `json:"queues"`
+	// Tasks are the names of the registered functions
+	Tasks     []string      `json:"tasks"`
+	Running   []*Task       `json:"running"`
+	Started   time.Time     `json:"started"`
+	Heartbeat time.Time     `json:"heartbeat"`
+	TTL       time.Duration `json:"ttl"`
+}
+
+// Task is a task being executed by the worker.
+type Task struct {
+	Id      string    `json:"id"`
+	Name    string    `json:"name"`
+	Started time.Time `json:"started"`
+}
+
+// Alive reports whether the worker sent a heartbeat within its TTL, workers
+// killed without unregistering are kept for a while as dead.
+func (w *Worker) Alive(now time.Time) bool {
+	return now.Sub(w.Heartbeat) < w.TTL
+}
+
+// Registry keeps the workers, like the redis registry.
+type Registry interface {
+	// Heartbeat registers or refreshes the worker
+	Heartbeat(ctx context.Context, w *Worker) error
+	// Unregister removes the worker stopped gracefully
+	Unregister(ctx context.Context, id string) error
+	// Workers returns the registered workers, including the dead ones
+	Workers(ctx context.Context) ([]*Worker, error)
+}
@@ -0,0 +1,207 @@
+package result
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// Error is the structured form of a task error, it keeps the message, code,
+// type and wrapped causes of the error returned by the handler when the
+// result is sent back to the producer.
+type Error struct {
+	Message   string                 `json:"message"`
+	Code      string                 `json:"code,omitempty"`
+	Type      string                 `json:"type,omitempty"`
+	Retryable bool                   `json:"retryable"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	Cause     *Error                 `json:"cause,omitempty"`
+
+	cause error
+}
+
+// 任务函数返回的错误可以实现以下接口以携带更多的信息
+type coder interface {
+	Code() string
+}
+
+type retryabler interface {
+	Retryable() bool
+}
+
+type detailer interface {
+	Details() map[string]interface{}
+}
+
+// maxErrorDepth limits the wrapped errors carried over the wire.
+const maxErrorDepth = 16
+
+var errRegistry = struct {
+	sync.RWMutex
+	sentinels map[string]error
+	types     map[string]reflect.Type
+}{
+	sentinels: make(map[string]error),
+	types:     make(map[string]reflect.Type),
+}
+
+// RegisterError registers a sentinel error. Decoded errors with the same code,
+// or the same type and message if the sentinel has no Code method, are
+// rebuilt as the sentinel so that errors.Is matches it.
+func RegisterError(sentinel error) {
+	key := sentinelKey(NewError(sentinel))
+
+	errRegistry.Lock()
+	defer errRegistry.Unlock()
+
+	errRegistry.sentinels[key] = sentinel
+}
+
+// RegisterErrorType registers the type of err. Decoded errors of that type are
+// rebuilt as a new value of the type with the exported fields restored from
+// the details, so that errors.As matches it.
+func RegisterErrorType(err error) {
+	t := reflect.TypeOf(err)
+
+	errRegistry.Lock()
+	defer errRegistry.Unlock()
+
+	errRegistry.types[typeName(t)] = t
+}
+
+// NewError converts err into its structured form. It returns nil for a nil
+// error.
+func NewError(err error) *Error {
+	return newError(err, 0)
+}
+
+func newError(err error, depth int) *Error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	e := &Error{
+		Message:   err.Error(),
+		Type:      typeName(reflect.TypeOf(err)),
+		Retryable: true,
+	}
+	if c, ok := err.(coder); ok {
+		e.Code = c.Code()
+	}
+	var r retryabler
+	if errors.As(err, &r) {
+		e.Retryable = r.Retryable()
+	}
+	if d, ok := err.(detailer); ok {
+		e.Details = d.Details()
+	} else if registeredType(e.Type) {
+		e.Details = fieldsOf(err)
+	}
+	if depth < maxErrorDepth {
+		e.Cause = newError(errors.Unwrap(err), depth+1)
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	if e.cause == nil && e.Cause != nil {
+		return e.Cause
+	}
+	return e.cause
+}
+
+// Err rebuilds the error on the producer side: registered sentinels and
+// error types are restored, anything else stays an *Error.
+func (e *Error) Err() error {
+	if e == nil {
+		return nil
+	}
+
+	errRegistry.RLock()
+	sentinel, ok := errRegistry.sentinels[sentinelKey(e)]
+	t := errRegistry.types[e.Type]
+	errRegistry.RUnlock()
+
+	if ok {
+		return sentinel
+	}
+	if t != nil {
+		if err := rebuild(t, e.Details); err != nil {
+			return err
+		}
+	}
+
+	c := *e
+	c.cause = e.Cause.Err()
+	return &c
+}
+
+func sentinelKey(e *Error) string {
+	if e.Code != "" {
+		return e.Code
+	}
+	return e.Type + ":" + e.Message
+}
+
+func registeredType(name string) bool {
+	errRegistry.RLock()
+	defer errRegistry.RUnlock()
+
+	_, ok := errRegistry.types[name]
+	return ok
+}
+
+func fieldsOf(err error) map[string]interface{} {
+	buf, jerr := json.Marshal(err)
+	if jerr != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(buf, &fields) != nil {
+		return nil
+	}
+	return fields
+}
+
+func rebuild(t reflect.Type, details map[string]interface{}) error {
+	var v reflect.Value
+	if t.Kind() == reflect.Ptr {
+		v = reflect.New(t.Elem())
+	} else {
+		v = reflect.New(t)
+	}
+
+	if len(details) > 0 {
+		buf, err := json.Marshal(details)
+		if err != nil {
+			return nil
+		}
+		if json.Unmarshal(buf, v.Interface()) != nil {
+			return nil
+		}
+	}
+
+	if t.Kind() != reflect.Ptr {
+		v = v.Elem()
+	}
+	err, _ := v.Interface().(error)
+	return err
+}
+
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		return "*" + typeName(t.Elem())
+	}
+	if t.Name() != "" && t.PkgPath() != "" {
+		return t.PkgPath() + "." + t.Name()
+	}
+	return t.String()
+}
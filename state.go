@@ -0,0 +1,80 @@
+package asq
+
+import (
+	"context"
+	"time"
+
+	"github.com/zigzed/asq/redact"
+	"github.com/zigzed/asq/task"
+)
+
+// StateStore keeps the last state of tasks by id, like the redis backend.
+// State returns nil for unknown or expired tasks.
+type StateStore interface {
+	SetState(ctx context.Context, st *task.State) error
+	State(ctx context.Context, id string) (*task.State, error)
+}
+
+// 记录任务状态的超时时间，监听器是同步调用的
+const stateTimeout = 5 * time.Second
+
+// WithStateStore records the state of tasks in store on every event, so they
+// can be looked up by id, e.g. by the admin handler. It costs a write to the
+// store per event.
+func WithStateStore(store StateStore) Options {
+	return func(app *App) {
+		app.states = store
+		app.listeners = append(app.listeners, stateListener(app, store))
+	}
+}
+
+// States returns the store of the task states, nil if not recorded.
+func (app *App) States() StateStore {
+	return app.states
+}
+
+func stateListener(app *App, store StateStore) Listener {
+	return func(e Event) {
+		st := &task.State{
+			Id:       e.Task.Id,
+			Name:     e.Task.Name,
+			Status:   stateStatus(e.Kind),
+			Worker:   e.Worker,
+			Attempts: e.Task.EnsureBackOff().Attempts,
+			Updated:  time.Now().UnixMilli(),
+		}
+		if e.Kind == EventSucceeded {
+			st.Results = redact.Results(e.Task.Name, e.Results)
+		}
+		if e.Err != nil {
+			st.Error = e.Err.Error()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), stateTimeout)
+		defer cancel()
+		if err := store.SetState(ctx, st); err != nil {
+			app.logger.Warn("asq: record task state failed",
+				"task", st.Name, "task_id", st.Id, "status", st.Status, "error", err)
+		}
+	}
+}
+
+func stateStatus(k EventKind) task.Status {
+	switch k {
+	case EventStarted:
+		return task.StatusStarted
+	case EventSucceeded:
+		return task.StatusSucceeded
+	case EventFailed:
+		return task.StatusFailed
+	case EventRetried:
+		return task.StatusRetrying
+	case EventDeadLettered:
+		return task.StatusDeadLettered
+	case EventRevoked:
+		return task.StatusRevoked
+	case EventGivenUp:
+		return task.StatusGivenUp
+	}
+	return task.StatusPending
+}
@@ -2,13 +2,23 @@ package task
 
 import (
 	"math"
+	"math/rand"
+	"sync"
 	"time"
 )
 
+// MaxRetryLater bounds the reschedules of a task by BackOff.Later if the
+// retry policy has no MaxElapsed.
+const MaxRetryLater = 24 * time.Hour
+
 type BackOff struct {
 	Attempts int
 	Factor   float64
 	Delay    time.Duration
+	// Prev is the last delay, used by decorrelated jitter
+	Prev time.Duration `json:",omitempty"`
+	// FirstFailure is the unix time in milliseconds of the first failure
+	FirstFailure int64 `json:",omitempty"`
 }
 
 func newBackOff(delay time.Duration, factor float64) *BackOff {
@@ -20,16 +30,99 @@ func newBackOff(delay time.Duration, factor float64) *BackOff {
 }
 
 func (bo *BackOff) NextAttempt() time.Duration {
-	next := bo.getNextAttempt(bo.Delay, bo.Factor, bo.Attempts)
-	bo.Attempts++
+	next, _ := bo.Next(nil)
 	return next
 }
 
+// Next returns the delay before the next attempt by the policy for the error
+// keys. It returns false if the policy gives up because of MaxElapsed. Without
+// a policy the delay grows by Factor.
+func (bo *BackOff) Next(policy *RetryPolicy, keys ...string) (time.Duration, bool) {
+	now := time.Now()
+	if bo.FirstFailure == 0 {
+		bo.FirstFailure = now.UnixMilli()
+	}
+
+	var next time.Duration
+	if policy == nil {
+		next = bo.getNextAttempt(bo.Delay, bo.Factor, bo.Attempts)
+	} else {
+		policy = policy.For(keys...)
+		next = policy.delay(bo.Prev, bo.Attempts)
+		if policy.MaxDelay > 0 && next > policy.MaxDelay {
+			next = policy.MaxDelay
+		}
+		if policy.MaxElapsed > 0 &&
+			now.Add(next).Sub(time.UnixMilli(bo.FirstFailure)) > policy.MaxElapsed {
+			return 0, false
+		}
+	}
+
+	bo.Prev = next
+	bo.Attempts++
+	return next, true
+}
+
+// Later records a reschedule asked by the task, e.g. by asq.RetryLaterError,
+// it doesn't count as an attempt. It returns false once the time since the
+// first failure would exceed MaxElapsed of the policy, or MaxRetryLater
+// without one.
+func (bo *BackOff) Later(policy *RetryPolicy, delay time.Duration, keys ...string) bool {
+	now := time.Now()
+	if bo.FirstFailure == 0 {
+		bo.FirstFailure = now.UnixMilli()
+	}
+
+	limit := MaxRetryLater
+	if policy != nil {
+		if p := policy.For(keys...); p.MaxElapsed > 0 {
+			limit = p.MaxElapsed
+		}
+	}
+	return now.Add(delay).Sub(time.UnixMilli(bo.FirstFailure)) <= limit
+}
+
 func (bo *BackOff) getNextAttempt(delay time.Duration, factor float64, attempts int) time.Duration {
-	d := time.Duration(delay.Seconds()*math.Pow(factor, float64(attempts+1))) * time.Second
-	return bo.addJitter(d, delay)
+	return clamp(exponential(delay, factor, attempts+1), DefaultMaxDelay)
 }
 
-func (bo *BackOff) addJitter(delay, unit time.Duration) time.Duration {
-	return delay
+// exponential 和 jitter 都用 float64 计算，最后由 clamp 转换，避免溢出成负数
+func exponential(delay time.Duration, factor float64, n int) float64 {
+	return float64(delay) * math.Pow(factor, float64(n))
+}
+
+// addJitter randomizes delay by up to +/- jitter of it.
+func addJitter(delay float64, jitter float64) float64 {
+	if jitter <= 0 {
+		return delay
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return delay + delay*jitter*(2*random()-1)
+}
+
+// clamp converts d to a delay between 0 and ceiling.
+func clamp(d float64, ceiling time.Duration) time.Duration {
+	if math.IsNaN(d) || d <= 0 {
+		return 0
+	}
+	if d >= float64(ceiling) {
+		return ceiling
+	}
+	return time.Duration(d)
+}
+
+var rnd = struct {
+	sync.Mutex
+	*rand.Rand
+}{
+	Rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+func random() float64 {
+	rnd.Lock()
+	defer rnd.Unlock()
+
+	return rnd.Float64()
 }
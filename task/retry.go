@@ -0,0 +1,142 @@
+package task
+
+import (
+	"math"
+	"time"
+)
+
+// MinDecorrelatedBase is the base of decorrelated delays not set or not
+// positive, which would never grow from zero.
+const MinDecorrelatedBase = 100 * time.Millisecond
+
+// DefaultMaxDelay caps the exponential and decorrelated delays if MaxDelay is
+// not set.
+const DefaultMaxDelay = 24 * time.Hour
+
+const (
+	RetryFixed        = "fixed"
+	RetryExponential  = "exponential"
+	RetryDecorrelated = "decorrelated"
+)
+
+// RetryPolicy decides the delay between retries. It is part of the task
+// option, so every worker retries the task the same way.
+type RetryPolicy struct {
+	// Kind is one of RetryFixed, RetryExponential and RetryDecorrelated
+	Kind string
+	// Delay is the fixed delay, or the base delay of the others
+	Delay time.Duration
+	// Factor is the growth of exponential delays, 2 if not set
+	Factor float64
+	// Jitter randomizes fixed and exponential delays by up to this fraction
+	Jitter float64
+	// MaxDelay caps the delay of a single retry if not zero
+	MaxDelay time.Duration
+	// MaxElapsed stops the retries once the time since the first failure
+	// would exceed it, if not zero
+	MaxElapsed time.Duration
+	// Overrides is the policy for errors by their code or type name
+	Overrides map[string]*RetryPolicy `json:",omitempty"`
+}
+
+func NewFixedRetry(delay time.Duration) *RetryPolicy {
+	return &RetryPolicy{Kind: RetryFixed, Delay: delay}
+}
+
+func NewExponentialRetry(delay time.Duration, factor float64) *RetryPolicy {
+	return &RetryPolicy{Kind: RetryExponential, Delay: delay, Factor: factor}
+}
+
+// NewDecorrelatedRetry picks a random delay between base and three times the
+// previous delay, see "Exponential Backoff And Jitter" on the AWS blog. The
+// base is at least MinDecorrelatedBase.
+func NewDecorrelatedRetry(base time.Duration) *RetryPolicy {
+	return &RetryPolicy{Kind: RetryDecorrelated, Delay: base}
+}
+
+func (rp *RetryPolicy) WithJitter(jitter float64) *RetryPolicy {
+	rp.Jitter = jitter
+	return rp
+}
+
+func (rp *RetryPolicy) WithMaxDelay(max time.Duration) *RetryPolicy {
+	rp.MaxDelay = max
+	return rp
+}
+
+func (rp *RetryPolicy) WithMaxElapsed(max time.Duration) *RetryPolicy {
+	rp.MaxElapsed = max
+	return rp
+}
+
+// WithOverride uses p for errors with the code or type name key, e.g.
+// "*net.OpError".
+func (rp *RetryPolicy) WithOverride(key string, p *RetryPolicy) *RetryPolicy {
+	if rp.Overrides == nil {
+		rp.Overrides = make(map[string]*RetryPolicy)
+	}
+	rp.Overrides[key] = p
+	return rp
+}
+
+// For returns the override of the first matching key, or the policy itself.
+// The override inherits MaxDelay and MaxElapsed if it doesn't set them.
+func (rp *RetryPolicy) For(keys ...string) *RetryPolicy {
+	for _, k := range keys {
+		if p, ok := rp.Overrides[k]; ok && p != nil {
+			o := *p
+			if o.MaxDelay == 0 {
+				o.MaxDelay = rp.MaxDelay
+			}
+			if o.MaxElapsed == 0 {
+				o.MaxElapsed = rp.MaxElapsed
+			}
+			return &o
+		}
+	}
+	return rp
+}
+
+func (rp *RetryPolicy) delay(prev time.Duration, attempts int) time.Duration {
+	switch rp.Kind {
+	case RetryExponential:
+		factor := rp.Factor
+		if factor <= 0 {
+			factor = 2
+		}
+		return clamp(addJitter(exponential(rp.Delay, factor, attempts), rp.Jitter), rp.ceiling())
+	case RetryDecorrelated:
+		// 没有 MaxDelay 时 prev 每次最多增长三倍，需要上限避免溢出
+		ceiling := rp.ceiling()
+		base := rp.Delay
+		if base <= 0 {
+			base = MinDecorrelatedBase
+		}
+		if prev < base {
+			prev = base
+		}
+		if prev > ceiling/3 {
+			prev = ceiling / 3
+		}
+		next := base + time.Duration(random()*float64(prev*3-base))
+		if next > ceiling {
+			next = ceiling
+		}
+		return next
+	default:
+		// 固定的延迟不受 DefaultMaxDelay 限制
+		ceiling := rp.MaxDelay
+		if ceiling <= 0 {
+			ceiling = math.MaxInt64
+		}
+		return clamp(addJitter(float64(rp.Delay), rp.Jitter), ceiling)
+	}
+}
+
+// ceiling is MaxDelay, or DefaultMaxDelay if not set.
+func (rp *RetryPolicy) ceiling() time.Duration {
+	if rp.MaxDelay > 0 {
+		return rp.MaxDelay
+	}
+	return DefaultMaxDelay
+}
@@ -0,0 +1,117 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cheekybits/is"
+)
+
+func TestLegacyBackOff(t *testing.T) {
+	is := is.New(t)
+
+	bo := newBackOff(100*time.Millisecond, 1.5)
+	is.Equal(bo.NextAttempt(), 150*time.Millisecond)
+	is.Equal(bo.NextAttempt(), 225*time.Millisecond)
+	is.Equal(bo.Attempts, 2)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	is := is.New(t)
+
+	p := NewExponentialRetry(time.Second, 2).WithMaxDelay(3 * time.Second)
+	bo := newBackOff(p.Delay, p.Factor)
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		next, ok := bo.Next(p)
+		is.True(ok)
+		is.Equal(next, expected)
+	}
+
+	p = NewFixedRetry(time.Second).WithJitter(0.5)
+	for i := 0; i < 100; i++ {
+		next, _ := bo.Next(p)
+		is.True(next >= 500*time.Millisecond && next <= 1500*time.Millisecond)
+	}
+
+	p = NewDecorrelatedRetry(time.Second).WithMaxDelay(time.Minute)
+	bo = newBackOff(p.Delay, p.Factor)
+	for i := 0; i < 100; i++ {
+		prev := bo.Prev
+		next, _ := bo.Next(p)
+		is.True(next >= time.Second && next <= time.Minute)
+		if prev > 0 {
+			is.True(next <= 3*prev)
+		}
+	}
+}
+
+func TestRetryPolicyLimits(t *testing.T) {
+	is := is.New(t)
+
+	p := NewFixedRetry(time.Minute).WithMaxElapsed(90*time.Second).
+		WithOverride("timeout", NewFixedRetry(time.Second))
+
+	bo := newBackOff(p.Delay, p.Factor)
+	next, ok := bo.Next(p, "*errors.errorString", "timeout")
+	is.True(ok)
+	is.Equal(next, time.Second)
+
+	next, ok = bo.Next(p)
+	is.True(ok)
+	is.Equal(next, time.Minute)
+
+	// 第一次失败已经过去了 45 秒，再等一分钟就超过了 90 秒
+	bo.FirstFailure = time.Now().Add(-45 * time.Second).UnixMilli()
+	_, ok = bo.Next(p)
+	is.False(ok)
+	is.Equal(bo.Attempts, 2)
+
+	// override 继承 MaxElapsed
+	bo.FirstFailure = time.Now().Add(-90 * time.Second).UnixMilli()
+	_, ok = bo.Next(p, "timeout")
+	is.False(ok)
+	is.Equal(p.For("timeout").MaxElapsed, 90*time.Second)
+	is.Equal(p.Overrides["timeout"].MaxElapsed, time.Duration(0))
+
+	// 没有 MaxDelay 的 exponential 加上 jitter 也不会溢出成负数
+	p = NewExponentialRetry(time.Second, 2).WithJitter(1)
+	bo = newBackOff(p.Delay, p.Factor)
+	bo.Attempts = 1000
+	for i := 0; i < 100; i++ {
+		next, ok := bo.Next(p)
+		is.True(ok)
+		is.True(next >= 0 && next <= DefaultMaxDelay)
+	}
+	legacy := newBackOff(time.Second, 2)
+	legacy.Attempts = 100
+	is.Equal(legacy.NextAttempt(), DefaultMaxDelay)
+
+	// 没有 base 的 decorrelated 也会等待
+	p = NewDecorrelatedRetry(0)
+	bo = newBackOff(p.Delay, p.Factor)
+	for i := 0; i < 10; i++ {
+		next, _ := bo.Next(p)
+		is.True(next >= MinDecorrelatedBase)
+	}
+
+	// 没有 MaxDelay 的 decorrelated 不会溢出
+	p = NewDecorrelatedRetry(time.Second)
+	bo = newBackOff(p.Delay, p.Factor)
+	for i := 0; i < 200; i++ {
+		next, _ := bo.Next(p)
+		is.True(next >= time.Second && next <= DefaultMaxDelay)
+	}
+}
+
+func TestRetryLater(t *testing.T) {
+	is := is.New(t)
+
+	bo := newBackOff(time.Second, 1.5)
+	is.True(bo.Later(nil, time.Hour))
+	is.False(bo.Later(nil, MaxRetryLater))
+	is.Equal(bo.Attempts, 0)
+
+	p := NewFixedRetry(time.Second).WithMaxElapsed(time.Minute)
+	is.True(bo.Later(nil, time.Hour))
+	is.False(bo.Later(p, time.Hour))
+}
@@ -0,0 +1,28 @@
+package task
+
+type Status string
+
+const (
+	StatusPending      Status = "pending"
+	StatusStarted      Status = "started"
+	StatusSucceeded    Status = "succeeded"
+	StatusFailed       Status = "failed"
+	StatusRetrying     Status = "retrying"
+	StatusDeadLettered Status = "dead_lettered"
+	StatusRevoked      Status = "revoked"
+	StatusGivenUp      Status = "given_up"
+)
+
+// State is the last known step of a task, recorded by the worker for
+// inspection. Results and Error are redacted text, not the values.
+type State struct {
+	Id       string
+	Name     string
+	Status   Status
+	Worker   string `json:",omitempty"`
+	Attempts int
+	Results  string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+	// Updated is when the state was recorded, in milliseconds
+	Updated int64
+}
@@ -12,6 +12,7 @@ type TaskOption struct {
 	ResultExpired int
 	IgnoreResult  bool
 	StartAt       *int64
+	Retry         *RetryPolicy `json:",omitempty"`
 }
 
 type Task struct {
@@ -22,6 +23,9 @@ type Task struct {
 	OnSuccess []*Task
 	OnFailed  []*Task
 	BackOff   *BackOff
+	Headers   map[string]string `json:",omitempty"`
+	// SubmittedAt is when the task was pushed to the broker, in milliseconds
+	SubmittedAt int64 `json:",omitempty"`
 }
 
 func NewTaskOption(retryCount int, retryTimeout time.Duration) *TaskOption {
@@ -44,6 +48,13 @@ func (to *TaskOption) WithStartAt(eta time.Time) *TaskOption {
 	return to
 }
 
+// WithRetryPolicy sets the delay between retries, the task is retried up to
+// RetryCount times.
+func (to *TaskOption) WithRetryPolicy(p *RetryPolicy) *TaskOption {
+	to.Retry = p
+	return to
+}
+
 func (to *TaskOption) WithResultExpired(in time.Duration) *TaskOption {
 	to.ResultExpired = int(in.Seconds())
 	return to
@@ -58,6 +69,48 @@ func NewTask(opt *TaskOption, name string, args ...interface{}) *Task {
 		Id:      uuid.New().String(),
 		Name:    name,
 		Args:    args,
-		BackOff: newBackOff(time.Duration(opt.RetryTimeout)*time.Millisecond, 1.5),
+		BackOff: opt.newBackOff(),
+	}
+}
+
+// EnsureBackOff creates the back off of tasks decoded without one, e.g. from
+// producers in other languages.
+func (t *Task) EnsureBackOff() *BackOff {
+	if t.BackOff == nil {
+		t.BackOff = t.Option.newBackOff()
+	}
+	return t.BackOff
+}
+
+func (to *TaskOption) newBackOff() *BackOff {
+	if to.Retry != nil {
+		return newBackOff(to.Retry.Delay, to.Retry.Factor)
+	}
+	return newBackOff(time.Duration(to.RetryTimeout)*time.Millisecond, 1.5)
+}
+
+// SetHeader sets metadata carried with the task, e.g. a request id. Headers
+// are copied onto the continuations when the task is executed.
+func (t *Task) SetHeader(key, value string) *Task {
+	if t.Headers == nil {
+		t.Headers = make(map[string]string)
+	}
+	t.Headers[key] = value
+	return t
+}
+
+// InheritHeaders copies the headers of parent into t and its continuations,
+// headers already set on them are kept.
+func (t *Task) InheritHeaders(parent *Task) {
+	for k, v := range parent.Headers {
+		if _, ok := t.Headers[k]; !ok {
+			t.SetHeader(k, v)
+		}
+	}
+	for _, x := range t.OnSuccess {
+		x.InheritHeaders(t)
+	}
+	for _, x := range t.OnFailed {
+		x.InheritHeaders(t)
 	}
 }
@@ -0,0 +1,72 @@
+package asq
+
+import (
+	"github.com/zigzed/asq/task"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/zigzed/asq"
+
+// WithTracerProvider sets the provider of the producer and consumer spans, the
+// global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Options {
+	return func(app *App) {
+		app.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// WithPropagator sets how the trace context is carried in the task headers,
+// W3C trace context by default.
+func WithPropagator(p propagation.TextMapPropagator) Options {
+	return func(app *App) {
+		app.propagator = p
+	}
+}
+
+func defaultTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(tracerName)
+}
+
+// headerCarrier injects the trace context into the task headers.
+type headerCarrier struct {
+	t *task.Task
+}
+
+func (hc headerCarrier) Get(key string) string {
+	return hc.t.Headers[key]
+}
+
+func (hc headerCarrier) Set(key, value string) {
+	hc.t.SetHeader(key, value)
+}
+
+func (hc headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(hc.t.Headers))
+	for k := range hc.t.Headers {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func taskAttributes(t *task.Task) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("messaging.system", "asq"),
+		attribute.String("messaging.message_id", t.Id),
+		attribute.String("asq.task.name", t.Name),
+	}
+	if t.BackOff != nil {
+		attrs = append(attrs, attribute.Int("asq.task.attempts", t.BackOff.Attempts))
+	}
+	return attrs
+}
+
+func recordError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
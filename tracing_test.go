@@ -0,0 +1,62 @@
+package asq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/task"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	is := is.New(t)
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	broker, backend := &memBroker{}, &memBackend{}
+	app := NewApp(broker, backend, WithTracerProvider(tp))
+	calls := 0
+	is.NoErr(app.Register("step", func(n int) (int, error) {
+		if calls++; calls == 2 {
+			return 0, errors.New("flaky")
+		}
+		return n + 1, nil
+	}))
+	w := app.newWorker()
+
+	// a -> b (失败后重试) -> 结果
+	_, err := app.SubmitTask(context.Background(),
+		task.NewTask(task.NewTaskOption(1, time.Second), "step", 1),
+		task.NewTask(task.NewTaskOption(1, time.Second), "step"))
+	is.NoErr(err)
+	for i := 0; i < 3; i++ {
+		is.Equal(len(broker.tasks), i+1)
+		is.NoErr(w.execute(context.Background(), broker.tasks[i]))
+	}
+	is.Equal(len(backend.results), 1)
+	is.Equal(backend.results[0].Results, []interface{}{3})
+
+	spans := exporter.GetSpans()
+	is.Equal(len(spans), 4)
+	submit, a, b, retry := spans[0], spans[1], spans[2], spans[3]
+	is.Equal(submit.Name, "asq.submit step")
+	is.Equal(submit.SpanKind, trace.SpanKindProducer)
+	is.Equal(a.SpanKind, trace.SpanKindConsumer)
+
+	// 整个任务链在同一个 trace 中
+	for _, s := range spans[1:] {
+		is.Equal(s.SpanContext.TraceID(), submit.SpanContext.TraceID())
+	}
+	is.Equal(a.Parent.SpanID(), submit.SpanContext.SpanID())
+	is.Equal(b.Parent.SpanID(), a.SpanContext.SpanID())
+	is.Equal(retry.Parent.SpanID(), b.SpanContext.SpanID())
+	is.Equal(b.Status.Code, codes.Error)
+	is.Equal(retry.Status.Code, codes.Unset)
+}
@@ -3,58 +3,112 @@ package asq
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"emperror.dev/errors"
+	"github.com/zigzed/asq/control"
 	"github.com/zigzed/asq/invoker"
+	"github.com/zigzed/asq/redact"
+	"github.com/zigzed/asq/registry"
 	"github.com/zigzed/asq/result"
 	"github.com/zigzed/asq/task"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Worker struct {
+	id      string
 	broker  Broker
 	backend Backend
 	logger  Logger
 	fnMgr   *fnManager
 	invoker Invoker
+
+	interceptors []Interceptor
+	tracer       trace.Tracer
+	propagator   propagation.TextMapPropagator
+	listeners    []Listener
+	deadLetters  bool
+
+	registry    registry.Registry
+	control     control.Transport
+	started     time.Time
+	concurrency int
+	mu          sync.Mutex
+	running     map[string]*registry.Task
+	limits      map[string]*rateLimiter
+	pool        *executors
+	stop        context.CancelFunc
+
+	paused    int32
+	succeeded int64
+	failed    int64
 }
 
-func newWorker(broker Broker, backend Backend, mgr *fnManager, logger Logger) *Worker {
+func newWorker(broker Broker, backend Backend, mgr *fnManager, logger Logger, vk Invoker) *Worker {
 	w := &Worker{
-		broker:  broker,
-		backend: backend,
-		logger:  logger,
-		fnMgr:   mgr,
-		invoker: invoker.NewGenericInvoker(),
+		id:         newWorkerID(),
+		broker:     broker,
+		backend:    backend,
+		logger:     logger,
+		fnMgr:      mgr,
+		invoker:    vk,
+		tracer:     defaultTracer(),
+		propagator: propagation.TraceContext{},
+		running:    make(map[string]*registry.Task),
+		limits:     make(map[string]*rateLimiter),
 	}
 	return w
 }
 
+// ID identifies the worker in events and logs.
+func (w *Worker) ID() string {
+	return w.id
+}
+
+// Start polls and executes the tasks with size executors until ctx is done
+// or the shutdown command is received.
 func (w *Worker) Start(ctx context.Context, size int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// 停止拉取任务后，已经拉取的任务继续执行完
+	pollCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
 	tasks := make(chan *task.Task, size)
-	defer func() {
-		close(tasks)
-	}()
+	pool := &executors{ctx: ctx, tasks: tasks, max: size * maxGrowth}
+	pool.wg.Add(1)
+	w.mu.Lock()
+	w.started, w.pool, w.stop = time.Now(), pool, stop
+	w.mu.Unlock()
+	if err := w.resize(size); err != nil {
+		w.logger.Error("asq: start worker failed", "worker", w.id, "error", err)
+		return
+	}
+
+	if w.registry != nil {
+		go w.heartbeat(ctx)
+	}
+	if w.control != nil {
+		go w.listen(ctx)
+	}
 
 	go func() {
-		w.doPoll(ctx, tasks)
+		w.doPoll(pollCtx, tasks)
+		w.mu.Lock()
+		pool.closed = true
+		w.mu.Unlock()
+		close(tasks)
+		pool.wg.Done()
 	}()
 
-	var wg sync.WaitGroup
-	wg.Add(size)
-	for i := 0; i < size; i++ {
-		go func() {
-			w.doExecute(ctx, tasks)
-			wg.Done()
-		}()
-	}
-
-	wg.Wait()
+	pool.wg.Wait()
 }
 
 func (w *Worker) doPoll(ctx context.Context, tasks chan<- *task.Task) {
-	w.logger.Infof("asq: polling task %v is starting...", w.fnMgr.registered())
-	defer w.logger.Infof("asq: polling task %v is stopped...", w.fnMgr.registered())
+	w.logger.Info("asq: polling is starting", "tasks", w.fnMgr.registered(), "worker", w.id)
+	defer w.logger.Info("asq: polling is stopped", "tasks", w.fnMgr.registered(), "worker", w.id)
 
 Loop:
 	for {
@@ -62,105 +116,306 @@ Loop:
 		case <-ctx.Done():
 			break Loop
 		default:
+			if w.isPaused() {
+				select {
+				case <-ctx.Done():
+				case <-time.After(pausedPoll):
+				}
+				continue
+			}
 			task, err := w.broker.Poll(ctx, 30*time.Second)
 			if err != nil && !errors.Is(err, context.Canceled) {
-				w.logger.Errorf("polling for task %v failed: %v", w.fnMgr.registered(), err)
+				w.logger.Error("asq: polling failed", "tasks", w.fnMgr.registered(), "worker", w.id, "error", err)
 				continue
 			}
-			if task != nil {
-				tasks <- task
+			if task == nil {
+				continue
+			}
+			select {
+			case tasks <- task:
+			case <-ctx.Done():
+				w.requeue(task)
 			}
 		}
 	}
 }
 
-func (w *Worker) doExecute(ctx context.Context, tasks <-chan *task.Task) {
+// requeue pushes back the task polled while stopping.
+func (w *Worker) requeue(task *task.Task) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := w.broker.Push(ctx, task); err != nil {
+		w.logger.Error("asq: requeue task failed", "task", task.Name, "task_id", task.Id,
+			"args", redact.ArgsAs(task.Name, task.Args, w.fnMgr.params(task.Name)), "error", err)
+	}
+}
+
+func (w *Worker) doExecute(ctx context.Context, tasks <-chan *task.Task, quit <-chan struct{}) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-quit:
+			return
 		case task, ok := <-tasks:
 			if !ok {
 				return
 			}
 			if err := w.execute(ctx, task); err != nil {
-				w.logger.Errorf("execute task %s with %v failed: %v", task.Name, task.Args, err)
+				w.logger.Error("asq: execute task failed", "task", task.Name, "task_id", task.Id,
+					"args", redact.ArgsAs(task.Name, task.Args, w.fnMgr.params(task.Name)), "error", err)
 			}
 		}
 	}
 }
 
-func (w *Worker) execute(ctx context.Context, task *task.Task) error {
+func (w *Worker) execute(ctx context.Context, task *task.Task) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			w.logger.Errorf("panic: execute task %+v failed: %v", task, r)
+			w.logger.Error("asq: panic in execute", "task", task.Name, "task_id", task.Id, "panic", r)
 		}
 	}()
 
-	fn, err := w.fnMgr.lookup(task.Name)
+	// 消费者 span 覆盖任务执行、重试和后续任务的推送
+	ctx = w.propagator.Extract(ctx, headerCarrier{task})
+	ctx, span := w.tracer.Start(ctx, "asq.execute "+task.Name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(taskAttributes(task)...))
+	defer func() {
+		recordError(span, err)
+		span.End()
+	}()
+
+	logger := w.logger.With("task", task.Name, "task_id", task.Id,
+		"attempt", task.EnsureBackOff().Attempts, "worker", w.id)
+	ctx = contextWithLogger(ctx, logger)
+
+	if revoked, err := w.revoked(ctx, task); err != nil {
+		logger.Warn("asq: check revoked task failed", "error", err)
+	} else if revoked {
+		return w.revoke(ctx, task)
+	}
+
+	h, err := w.fnMgr.lookup(task.Name)
 	if err != nil {
 		return errors.Wrapf(err, "function %s not found", task.Name)
 	}
+	if throttled, err := w.throttle(ctx, task, h); err != nil {
+		return errors.Wrapf(err, "reschedule %s over its rate limit failed", task.Name)
+	} else if throttled {
+		return nil
+	}
+
+	start := time.Now()
+	w.track(task, start)
+	defer w.untrack(task.Id)
+	w.emit(Event{Kind: EventStarted, Task: task, Wait: queueWait(task, start)})
+
+	ctx = contextWithHeaders(ctx, task.Headers)
+	returns, failed := w.invoke(ctx, task, chainInterceptors(w.interceptors, w.handler(h)))
+	kind := EventSucceeded
+	if failed != nil {
+		kind = EventFailed
+		atomic.AddInt64(&w.failed, 1)
+	} else {
+		atomic.AddInt64(&w.succeeded, 1)
+	}
+	w.emit(Event{Kind: kind, Task: task, Duration: time.Since(start), Results: returns, Err: failed})
+
+	var ie *invokeError
+	if errors.As(failed, &ie) {
+		return errors.Wrapf(ie.err, "execute %s failed", redact.TaskAs(task, w.fnMgr.params(task.Name)))
+	}
+
+	// 函数执行没有返回错误
+	if failed == nil {
+		if len(task.OnSuccess) == 0 {
+			if !task.Option.IgnoreResult {
+				return w.backend.Push(ctx,
+					result.NewResult(
+						task.Id,
+						task.Name,
+						returns,
+						nil,
+						time.Duration(task.Option.ResultExpired)*time.Second))
+			}
+			return nil
+		}
+		task.OnSuccess[0].InheritHeaders(task)
+		task = task.OnSuccess[0]
+		if len(returns) >= 1 {
+			task.Args = append(task.Args, returns...)
+		}
+		w.propagator.Inject(ctx, headerCarrier{task})
+		task.SubmittedAt = time.Now().UnixMilli()
+		if err := w.broker.Push(ctx, task); err != nil {
+			return err
+		}
+		w.emit(Event{Kind: EventSubmitted, Task: task})
+		return nil
+	}
+	recordError(span, failed)
 
-	var lastError interface{}
-	invoke := func(p Invoker, fn interface{}, args []interface{}) ([]interface{}, error) {
+	var later *RetryLaterError
+	if errors.As(failed, &later) {
+		if !task.EnsureBackOff().Later(task.Option.Retry, later.Delay, errorKeys(failed)...) {
+			logger.Warn("asq: task rescheduled for too long", "delay", later.Delay, "error", failed)
+			return w.fail(ctx, task, returns, failed)
+		}
+		logger.Info("asq: task asks for retry", "delay", later.Delay, "error", failed)
+		return w.schedule(ctx, task, later.Delay, failed)
+	}
+
+	if task.Option.RetryCount <= task.EnsureBackOff().Attempts || isPermanent(failed) {
+		return w.fail(ctx, task, returns, failed)
+	}
+
+	nextAttempt, ok := task.BackOff.Next(task.Option.Retry, errorKeys(failed)...)
+	if !ok {
+		return w.fail(ctx, task, returns, failed)
+	}
+	logger.Error("asq: task failed, will retry", "delay", nextAttempt, "error", failed)
+	return w.schedule(ctx, task, nextAttempt, failed)
+}
+
+// invokeError is an error of the invoker instead of the function, e.g. the
+// args do not match, the task is dropped instead of retried.
+type invokeError struct {
+	err error
+}
+
+func (e *invokeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *invokeError) Unwrap() error {
+	return e.err
+}
+
+// handler invokes the function of h, it is the innermost Handler of the
+// interceptors.
+func (w *Worker) handler(h *fnHandler) Handler {
+	// 优先使用注册时指定的 Invoker，其次是 App 的 Invoker，然后是 asqgen 生成的
+	// 调用桩，最后才是反射
+	vk := h.invoker
+	if vk == nil {
+		vk = w.invoker
+	}
+	if vk == nil {
+		if typed, ok := invoker.LookupTyped(h.fn); ok {
+			vk = typed
+		} else {
+			vk = invoker.NewGenericInvoker(invoker.WithLogger(w.logger))
+		}
+	}
+
+	withContext, withError := takesContext(h.fn), returnsError(h.fn)
+
+	return func(ctx context.Context, task *task.Task) (returns []interface{}, failed error) {
 		defer func() {
 			if r := recover(); r != nil {
-				lastError = errors.Errorf("panic: invoke %+v failed: %v", task, r)
-				w.logger.Errorf("panic: invoke %+v failed: %v", task, r)
+				returns, failed = nil, errors.Errorf("panic: invoke %s failed: %v", redact.TaskAs(task, h.params), r)
+				LoggerFromContext(ctx).Error("asq: panic in task", "panic", r)
 			}
 		}()
-		return p.Invoke(fn, args)
+
+		args := task.Args
+		if withContext {
+			args = append([]interface{}{ctx}, args...)
+		}
+		returns, err := vk.Invoke(h.fn, args)
+		if err != nil {
+			return nil, &invokeError{err: err}
+		}
+		if len(returns) == 0 || !withError {
+			return returns, nil
+		}
+		failed, _ = returns[len(returns)-1].(error)
+		return returns[:len(returns)-1], failed
 	}
+}
 
-	returns, err := invoke(w.invoker, fn, task.Args)
-	if err != nil {
-		return errors.Wrapf(err, "execute %+v failed", task)
-	}
-
-	if len(returns) > 0 {
-		lastError, returns = returns[len(returns)-1], returns[:len(returns)-1]
-		// 函数执行没有返回错误
-		if lastError == nil {
-			if len(task.OnSuccess) == 0 {
-				if !task.Option.IgnoreResult {
-					return w.backend.Push(ctx,
-						result.NewResult(
-							task.Id,
-							task.Name,
-							returns,
-							nil,
-							time.Duration(task.Option.ResultExpired)*time.Second))
-				}
-				return nil
-			}
-			task = task.OnSuccess[0]
-			if len(returns) >= 1 {
-				task.Args = append(task.Args, returns...)
-			}
-			return w.broker.Push(ctx, task)
+// invoke calls the handler chain, a panic of the interceptors fails the task
+// like a panic of the function.
+func (w *Worker) invoke(ctx context.Context, task *task.Task, handler Handler) (returns []interface{}, failed error) {
+	defer func() {
+		if r := recover(); r != nil {
+			returns, failed = nil, errors.Errorf("panic: execute %s failed: %v", redact.TaskAs(task, w.fnMgr.params(task.Name)), r)
+			LoggerFromContext(ctx).Error("asq: panic in interceptor", "panic", r)
+		}
+	}()
+	return handler(ctx, task)
+}
+
+func (w *Worker) fail(ctx context.Context, task *task.Task, returns []interface{}, failed error) error {
+	// 最后一次失败总要报告一个终止的事件，wait 据此结束
+	kind := EventGivenUp
+	if dl, ok := w.broker.(DeadLetterer); ok && w.deadLetters {
+		if err := dl.DeadLetter(ctx, task, failed); err != nil {
+			LoggerFromContext(ctx).Error("asq: dead letter task failed", "error", err)
+		} else {
+			kind = EventDeadLettered
 		}
 	}
+	w.emit(Event{Kind: kind, Task: task, Err: failed})
+
+	rer := w.backend.Push(ctx,
+		result.NewResult(
+			task.Id,
+			task.Name,
+			returns,
+			failed,
+			time.Duration(task.Option.ResultExpired)*time.Second))
+	LoggerFromContext(ctx).Error("asq: task failed", "error", failed)
+	return rer
+}
 
-	if task.Option.RetryCount <= task.BackOff.Attempts {
-		err, _ := lastError.(error)
-		rer := w.backend.Push(ctx,
-			result.NewResult(
-				task.Id,
-				task.Name,
-				returns,
-				err,
-				time.Duration(task.Option.ResultExpired)*time.Second))
-		w.logger.Errorf("task %s, %s failed: %v", task.Name, task.Id, err)
-		return rer
+// revoked checks the task against the revoked tasks of the broker, if it
+// supports revoking.
+func (w *Worker) revoked(ctx context.Context, task *task.Task) (bool, error) {
+	r, ok := w.broker.(Revoker)
+	if !ok {
+		return false, nil
 	}
+	return r.Revoked(ctx, task.Id)
+}
 
-	nextAttempt := task.BackOff.NextAttempt()
-	w.logger.Errorf("task %s, %s failed: %v, next attempt in %.3f seconds",
-		task.Name, task.Id, lastError, nextAttempt.Seconds())
+// revoke drops the task, the waiting caller gets ErrRevoked.
+func (w *Worker) revoke(ctx context.Context, task *task.Task) error {
+	LoggerFromContext(ctx).Info("asq: task revoked, dropped")
+	w.emit(Event{Kind: EventRevoked, Task: task, Err: ErrRevoked})
+	if task.Option.IgnoreResult {
+		return nil
+	}
+	return w.backend.Push(ctx,
+		result.NewResult(
+			task.Id,
+			task.Name,
+			nil,
+			ErrRevoked,
+			time.Duration(task.Option.ResultExpired)*time.Second))
+}
 
-	scheduleAt := time.Now().Add(nextAttempt).UnixMilli()
+func (w *Worker) schedule(ctx context.Context, task *task.Task, delay time.Duration, reason error) error {
+	if err := w.reschedule(ctx, task, delay); err != nil {
+		return err
+	}
+	w.emit(Event{Kind: EventRetried, Task: task, Err: reason})
+	return nil
+}
+
+// reschedule pushes the task back to start after delay, without an event.
+func (w *Worker) reschedule(ctx context.Context, task *task.Task, delay time.Duration) error {
+	scheduleAt := time.Now().Add(delay).UnixMilli()
 	task.Option.StartAt = new(int64)
 	*task.Option.StartAt = scheduleAt
+	w.propagator.Inject(ctx, headerCarrier{task})
+	task.SubmittedAt = time.Now().UnixMilli()
 	return w.broker.Push(ctx, task)
 }
+
+func (w *Worker) emit(e Event) {
+	e.Worker = w.id
+	emit(w.listeners, e)
+}
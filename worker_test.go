@@ -0,0 +1,247 @@
+package asq
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/cheekybits/is"
+	"github.com/zigzed/asq/marshaller"
+	"github.com/zigzed/asq/redact"
+	"github.com/zigzed/asq/result"
+	"github.com/zigzed/asq/task"
+)
+
+// memBroker 和 memBackend 记录推送的任务和结果，用于不依赖 redis 的测试
+type memBroker struct {
+	sync.Mutex
+	tasks   []*task.Task
+	dead    []*task.Task
+	revoked map[string]bool
+}
+
+func (mb *memBroker) Push(ctx context.Context, t *task.Task) error {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mb.tasks = append(mb.tasks, t)
+	return nil
+}
+
+func (mb *memBroker) DeadLetter(ctx context.Context, t *task.Task, reason error) error {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mb.dead = append(mb.dead, t)
+	return nil
+}
+
+func (mb *memBroker) Revoked(ctx context.Context, id string) (bool, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	return mb.revoked[id], nil
+}
+
+func (mb *memBroker) Len(ctx context.Context) (int64, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	return int64(len(mb.tasks)), nil
+}
+
+func (mb *memBroker) DelayedLen(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (mb *memBroker) Peek(ctx context.Context, offset, count int64) ([]*task.Task, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	if offset >= int64(len(mb.tasks)) {
+		return nil, nil
+	}
+	if end := offset + count; end < int64(len(mb.tasks)) {
+		return mb.tasks[offset:end], nil
+	}
+	return mb.tasks[offset:], nil
+}
+
+func (mb *memBroker) Purge(ctx context.Context) (int64, error) {
+	mb.Lock()
+	defer mb.Unlock()
+
+	n := len(mb.tasks)
+	mb.tasks = nil
+	return int64(n), nil
+}
+
+func (mb *memBroker) Poll(ctx context.Context, timeout time.Duration) (*task.Task, error) {
+	return nil, nil
+}
+
+type memBackend struct {
+	sync.Mutex
+	results []*result.Result
+}
+
+func (mb *memBackend) Push(ctx context.Context, r *result.Result) error {
+	mb.Lock()
+	defer mb.Unlock()
+
+	mb.results = append(mb.results, r)
+	return nil
+}
+
+func (mb *memBackend) Scan(ctx context.Context, id, name string, args ...interface{}) (bool, error) {
+	return false, nil
+}
+
+func newMemWorker(t *testing.T, name string, fn interface{}, opts ...Options) (*Worker, *memBroker, *memBackend) {
+	broker, backend := &memBroker{}, &memBackend{}
+	app := NewApp(broker, backend, opts...)
+	if err := app.Register(name, fn); err != nil {
+		t.Fatal(err)
+	}
+	return app.newWorker(), broker, backend
+}
+
+func TestPermanentError(t *testing.T) {
+	is := is.New(t)
+
+	errInvalid := errors.New("invalid")
+	calls := 0
+	w, broker, backend := newMemWorker(t, "validate", func() error {
+		calls++
+		return NewPermanentError(errInvalid)
+	})
+
+	err := w.execute(context.Background(), task.NewTask(task.NewTaskOption(3, time.Second), "validate"))
+	is.NoErr(err)
+	is.Equal(calls, 1)
+	is.Equal(len(broker.tasks), 0)
+	is.Equal(len(backend.results), 1)
+	is.True(errors.Is(backend.results[0].Error, errInvalid))
+	is.False(result.NewError(backend.results[0].Error).Retryable)
+	// 未启用死信队列
+	is.Equal(len(broker.dead), 0)
+}
+
+func TestRetryLaterError(t *testing.T) {
+	is := is.New(t)
+
+	w, broker, backend := newMemWorker(t, "poll", func() error {
+		return NewRetryLaterError(errors.New("not ready"), time.Minute)
+	}, WithDeadLetters())
+
+	t1 := task.NewTask(task.NewTaskOption(1, time.Second), "poll")
+	now := time.Now()
+	is.NoErr(w.execute(context.Background(), t1))
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(backend.results), 0)
+	is.Equal(len(broker.tasks), 2)
+	is.Equal(broker.tasks[1].BackOff.Attempts, 0)
+	is.True(*broker.tasks[1].Option.StartAt >= now.Add(time.Minute).UnixMilli())
+
+	// 超过 MaxRetryLater 以后失败
+	t1.BackOff.FirstFailure = now.Add(-task.MaxRetryLater).UnixMilli()
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(broker.tasks), 2)
+	is.Equal(len(backend.results), 1)
+	is.Equal(len(broker.dead), 1)
+}
+
+func TestRetryError(t *testing.T) {
+	is := is.New(t)
+
+	w, broker, backend := newMemWorker(t, "flaky", func() error {
+		return errors.New("flaky")
+	})
+
+	t1 := task.NewTask(task.NewTaskOption(1, time.Second), "flaky")
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(broker.tasks), 1)
+	is.Equal(broker.tasks[0].BackOff.Attempts, 1)
+
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(broker.tasks), 1)
+	is.Equal(len(backend.results), 1)
+}
+
+func TestRedactedErrors(t *testing.T) {
+	is := is.New(t)
+
+	redact.MaskArgs("login", 1)
+	w, _, backend := newMemWorker(t, "login", func(user, password string) error {
+		panic("boom")
+	})
+
+	t1 := task.NewTask(task.NewTaskOption(0, time.Second), "login", "bob", "hunter2")
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(backend.results), 1)
+	is.True(strings.Contains(backend.results[0].Error.Error(), "[bob ***]"))
+
+	// 参数个数不匹配
+	err := w.execute(context.Background(), task.NewTask(nil, "login", "bob", "hunter2", "extra"))
+	is.Err(err)
+	is.True(strings.Contains(err.Error(), "[bob *** extra]"))
+	is.False(strings.Contains(err.Error(), "hunter2"))
+}
+
+func TestRedactedDecodedArgs(t *testing.T) {
+	is := is.New(t)
+
+	type card struct {
+		Holder string
+		Number string `asq:"redact"`
+	}
+	w, _, backend := newMemWorker(t, "pay", func(ctx context.Context, c card, amount int) error {
+		panic("boom")
+	})
+
+	// worker 收到的是 JSON 解码出的 map，没有 struct tag
+	m := marshaller.NewJsonMarshaller()
+	buf, err := m.EncodeTask(task.NewTask(task.NewTaskOption(0, time.Second), "pay", card{"bob", "4111"}, 100))
+	is.NoErr(err)
+	t1, err := m.DecodeTask(buf)
+	is.NoErr(err)
+	_, ok := t1.Args[0].(map[string]interface{})
+	is.True(ok)
+
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(len(backend.results), 1)
+	msg := backend.results[0].Error.Error()
+	is.True(strings.Contains(msg, "[map[Holder:bob Number:***] 100]"))
+	is.False(strings.Contains(msg, "4111"))
+
+	// 参数类型属于各自的 app，同名的任务互不覆盖
+	type plain struct {
+		Holder string
+		Number string
+	}
+	app1, app2 := NewApp(&memBroker{}, &memBackend{}), NewApp(&memBroker{}, &memBackend{})
+	is.NoErr(app1.Register("pay", func(c card, amount int) {}))
+	is.NoErr(app2.Register("pay", func(c plain, amount int) {}))
+	is.Equal(app1.RedactArgs(t1), "[map[Holder:bob Number:***] 100]")
+	is.True(strings.Contains(app2.RedactArgs(t1), "Number:4111"))
+}
+
+func TestRevokedTask(t *testing.T) {
+	is := is.New(t)
+
+	calls := 0
+	w, broker, backend := newMemWorker(t, "send", func() error {
+		calls++
+		return nil
+	})
+
+	t1 := task.NewTask(nil, "send")
+	broker.revoked = map[string]bool{t1.Id: true}
+	is.NoErr(w.execute(context.Background(), t1))
+	is.Equal(calls, 0)
+	is.Equal(len(backend.results), 1)
+	is.True(errors.Is(backend.results[0].Error, ErrRevoked))
+}